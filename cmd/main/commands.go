@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+)
+
+// command is a one-off task run instead of the HTTP server, e.g. `e-campus-be keygen`
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"keygen":            {"Generate a new encryption key for APP_KEYS or DATA_KEYS", keygen},
+	"import-users":      {"Create users from a CSV or XLSX file", importUsers},
+	"nim-nip":           {"Find missing or duplicated NIM/NIPs and renumber them", nimNip},
+	"reencrypt-secrets": {"Re-encrypt stored secrets with the active data key", reencryptSecrets},
+}
+
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: e-campus-be [command]")
+	fmt.Fprintln(os.Stderr, "\nWithout a command the HTTP server is started.\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].description)
+	}
+}
+
+// openDatabase connects to the database for commands, which run without the
+// fx application
+func openDatabase(cfg config.Config) (*database.ECampusDB, error) {
+	conn, err := sqlx.Connect("pgx", cfg.Database.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.NewECampusDBImpl(conn), nil
+}
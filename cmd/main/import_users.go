@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// importUsers creates users from a CSV or XLSX file, like POST /users/import.
+// The JSON report, including generated passwords, is written to stdout.
+func importUsers(args []string) error {
+	flags := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: e-campus-be import-users [-dry-run] <file.csv|file.xlsx>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one file")
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := services.ParseUserImport(file.Name(), file)
+	if err != nil {
+		return err
+	}
+
+	report, err := services.NewUserImportService(db, cfg).Import(rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d rows, %d invalid, %d created\n", report.Total, report.Invalid, report.Created)
+	if report.Invalid > 0 {
+		return errors.New("the file has invalid rows, nothing was imported")
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// keygen prints a new key in APP_KEYS or DATA_KEYS format.
+//
+// Session keys: add the new key to APP_KEYS, point APP_KEY_ID at it, and drop
+// the old key once every token encrypted with it has expired.
+//
+// Data keys encrypt secrets stored in the database, which never expire: add
+// the new key to DATA_KEYS, point DATA_KEY_ID at it, run reencrypt-secrets,
+// and only then drop the old key. Dropping it earlier locks users out of 2FA.
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	id := flags.String("id", "", "key id (defaults to k<unix time>)")
+	data := flags.Bool("data", false, "print guidance for DATA_KEYS instead of APP_KEYS")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	keyID, key, err := utils.GenerateEncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	if *id != "" {
+		if !config.ValidKeyID(*id) {
+			return errors.New("id may only contain letters, digits, '-' and '_'")
+		}
+		keyID = *id
+	}
+
+	fmt.Printf("%s:%s\n\n", keyID, key)
+	if *data {
+		fmt.Println("Prepend this entry to DATA_KEYS (comma separated), set")
+		fmt.Printf("DATA_KEY_ID=%s and run `e-campus-be reencrypt-secrets`.\n", keyID)
+		fmt.Println("Keep the old key until reencrypt-secrets has succeeded.")
+		return nil
+	}
+
+	fmt.Println("Prepend this entry to APP_KEYS (comma separated) and set")
+	fmt.Printf("APP_KEY_ID=%s to encrypt new tokens with it.\n", keyID)
+	fmt.Println("Keep the old key until tokens encrypted with it have expired.")
+	fmt.Println("Without DATA_KEYS it also encrypts 2FA secrets: set DATA_KEYS")
+	fmt.Println("(see keygen -data) and run reencrypt-secrets before dropping it.")
+
+	return nil
+}
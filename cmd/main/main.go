@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/rafaalrazzak/e-campus-be/internal/http"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/storage"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -18,6 +22,8 @@ func Providers() fx.Option {
 			database.NewECampusDBImpl,
 			redis.NewRedisConn,
 			redis.NewECampusRedisDBImpl,
+			mailer.NewMailer,
+			storage.NewStorage,
 			http.NewFiberApp,
 		),
 	)
@@ -32,5 +38,10 @@ func Entrypoint() fx.Option {
 }
 
 func Run() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	fx.New(Providers(), Entrypoint()).Run()
 }
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// nimNip reports users with a missing or duplicated NIM/NIP and, with -fix,
+// renumbers them using the numbering rules. Run it before the migration that
+// makes users.nim_nip unique when that migration fails.
+func nimNip(args []string) error {
+	flags := flag.NewFlagSet("nim-nip", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "renumber the users found")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: e-campus-be nim-nip [-fix]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	report, err := services.NewNumberingService(db).CheckNimNips(*fix)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d issues, %d renumbered\n", len(report.Issues), report.Renumbered)
+	if len(report.Issues) > report.Renumbered {
+		return errors.New("some users still need a unique NIM/NIP")
+	}
+
+	return nil
+}
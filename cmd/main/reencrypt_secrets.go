@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// reencryptSecrets rewrites the secrets stored in the database with the active
+// data key. Run it after pointing DATA_KEY_ID at a new key and before dropping
+// the old key from DATA_KEYS (or APP_KEYS, for secrets stored before DATA_KEYS).
+func reencryptSecrets(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	rewritten, err := services.NewTwoFactorService(db, nil, cfg, nil).ReencryptSecrets()
+	fmt.Printf("%d two-factor secrets re-encrypted\n", rewritten)
+
+	return err
+}
@@ -3,21 +3,129 @@ package constants
 import "time"
 
 type RedisKeys struct {
-	SessionKey   string
-	UserCacheKey string
-	ProductKey   string
+	SessionKey            string
+	RefreshTokenKey       string
+	UserSessionsKey       string
+	PasswordResetKey      string
+	TwoFactorChallengeKey string
+	LoginAttemptsKey      string
+	LoginLockKey          string
+	OIDCStateKey          string
+	WebAuthnCeremonyKey   string
+	UserCacheKey          string
+	PermissionsCacheKey   string
 }
 
 type AppConstants struct {
-	SessionExpiration time.Duration
+	AccessTokenExpiration        time.Duration
+	SessionTouchInterval         time.Duration
+	PasswordResetExpiration      time.Duration
+	TwoFactorChallengeExpiration time.Duration
+	TwoFactorMaxAttempts         int64
+	TwoFactorIssuer              string
+	RecoveryCodeCount            int
+	LoginFreeAttempts            int64
+	LoginBackoffBase             time.Duration
+	LoginBackoffMax              time.Duration
+	LoginFailureWindow           time.Duration
+	LoginEmailLockoutThreshold   int64
+	LoginIPLockoutThreshold      int64
+	LoginLockoutDuration         time.Duration
+	OIDCStateExpiration          time.Duration
+	APIKeyPrefix                 string
+	APIKeyDefaultExpiration      time.Duration
+	APIKeyMaxExpiration          time.Duration
+	ImpersonationExpiration      time.Duration
+	EmailVerificationExpiration  time.Duration
+	WebAuthnCeremonyExpiration   time.Duration
+	PhotoMaxSize                 int
+	PhotoMaxPixels               int
+	UserCacheExpiration          time.Duration
+	PermissionsCacheExpiration   time.Duration
 }
 
 var App = AppConstants{
-	SessionExpiration: 24 * time.Hour,
+	AccessTokenExpiration:        15 * time.Minute,
+	SessionTouchInterval:         time.Minute,
+	PasswordResetExpiration:      30 * time.Minute,
+	TwoFactorChallengeExpiration: 5 * time.Minute,
+	TwoFactorMaxAttempts:         5,
+	TwoFactorIssuer:              "E-Campus",
+	RecoveryCodeCount:            10,
+	LoginFreeAttempts:            3,
+	LoginBackoffBase:             time.Second,
+	LoginBackoffMax:              5 * time.Minute,
+	LoginFailureWindow:           15 * time.Minute,
+	LoginEmailLockoutThreshold:   10,
+	LoginIPLockoutThreshold:      50,
+	LoginLockoutDuration:         15 * time.Minute,
+	OIDCStateExpiration:          10 * time.Minute,
+	APIKeyPrefix:                 "eck_",
+	APIKeyDefaultExpiration:      90 * 24 * time.Hour,
+	APIKeyMaxExpiration:          365 * 24 * time.Hour,
+	ImpersonationExpiration:      30 * time.Minute,
+	EmailVerificationExpiration:  48 * time.Hour,
+	WebAuthnCeremonyExpiration:   5 * time.Minute,
+	PhotoMaxSize:                 8 << 20,    // bytes
+	PhotoMaxPixels:               40_000_000, // width * height
+	UserCacheExpiration:          5 * time.Minute,
+	PermissionsCacheExpiration:   5 * time.Minute,
 }
 
 var Redis = RedisKeys{
-	SessionKey:   "ecampus:session::%d::%d",  // session:userId:sessionToken
-	UserCacheKey: "ecampus:cache:user:%s",    // cache:user:userId
-	ProductKey:   "ecampus:cache:product:%s", // cache:product:productId
+	SessionKey:            "ecampus:session::%d::%d",        // session:userId:sessionId
+	RefreshTokenKey:       "ecampus:refresh::%d::%d",        // refresh:userId:sessionId
+	UserSessionsKey:       "ecampus:sessions::%d",           // sessions:userId (sorted set of session ids)
+	PasswordResetKey:      "ecampus:password-reset::%s",     // password-reset:tokenHash
+	TwoFactorChallengeKey: "ecampus:2fa-challenge::%s",      // 2fa-challenge:tokenHash
+	LoginAttemptsKey:      "ecampus:login-attempts::%s::%s", // login-attempts:scope:value (scope is email or ip)
+	LoginLockKey:          "ecampus:login-lock::%s::%s",     // login-lock:scope:value
+	OIDCStateKey:          "ecampus:oidc-state::%s",         // oidc-state:state
+	WebAuthnCeremonyKey:   "ecampus:webauthn-ceremony::%s",  // webauthn-ceremony:tokenHash
+	UserCacheKey:          "ecampus:cache:user:%s",          // cache:user:userId
+	PermissionsCacheKey:   "ecampus:cache:permissions:%s",   // cache:permissions:role
+}
+
+// PermissionNames lists the permissions checked by the API. Roles are granted
+// permissions through the role_permissions table.
+type PermissionNames struct {
+	UsersRead             string
+	UsersCreate           string
+	UsersUpdate           string
+	UsersDelete           string
+	UsersUnlock           string
+	UsersImpersonate      string
+	UsersPurge            string
+	UsersExport           string
+	RegistrationsManage   string
+	SessionsRevoke        string
+	SessionsManage        string
+	NumberingManage       string
+	RolesManage           string
+	TwoFactorManage       string
+	ServiceAccountsManage string
+	GradesPublish         string
+	MetricsRead           string
+	LecturersManage       string
+}
+
+var Permissions = PermissionNames{
+	UsersRead:             "users:read",
+	UsersCreate:           "users:create",
+	UsersUpdate:           "users:update",
+	UsersDelete:           "users:delete",
+	UsersUnlock:           "users:unlock",
+	UsersImpersonate:      "users:impersonate",
+	UsersPurge:            "users:purge",
+	UsersExport:           "users:export",
+	RegistrationsManage:   "registrations:manage",
+	SessionsRevoke:        "sessions:revoke",
+	SessionsManage:        "sessions:manage",
+	NumberingManage:       "numbering:manage",
+	RolesManage:           "roles:manage",
+	TwoFactorManage:       "two-factor:manage",
+	ServiceAccountsManage: "service-accounts:manage",
+	GradesPublish:         "grades:publish",
+	MetricsRead:           "metrics:read",
+	LecturersManage:       "lecturers:manage",
 }
@@ -3,41 +3,254 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
 	"github.com/rafaalrazzak/e-campus-be/internal/services"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService          *services.AuthService
+	passwordResetService *services.PasswordResetService
+	webAuthnService      *services.WebAuthnService
 }
 
-func NewAuthController(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config) *AuthController {
+func NewAuthController(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, mail mailer.Mailer) *AuthController {
+	authService := services.NewAuthService(db, redisClient, cfg)
+
 	return &AuthController{
-		authService: services.NewAuthService(db, redisClient, cfg),
+		authService:          authService,
+		passwordResetService: services.NewPasswordResetService(db, redisClient, cfg, mail, authService),
+		webAuthnService:      services.NewWebAuthnService(db, redisClient, cfg, authService),
 	}
 }
 
 // Login handles user authentication
 func (ctrl *AuthController) Login() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		var inputUser models.User
+		var input services.LoginInput
 
-		if err := c.BodyParser(&inputUser); err != nil {
+		if err := c.BodyParser(&input); err != nil {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
 		}
 
-		token, err := ctrl.authService.AuthenticateUser(inputUser)
+		result, err := ctrl.authService.AuthenticateUser(input, clientInfo(c))
 		if err != nil {
 			return err
 		}
 
-		return c.Status(http.StatusOK).JSON(fiber.Map{
-			"token": token,
+		return c.Status(http.StatusOK).JSON(result)
+	}
+}
+
+// Refresh rotates a refresh token into a new access and refresh token pair
+func (ctrl *AuthController) Refresh() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.RefreshTokenInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		tokens, err := ctrl.authService.RefreshSession(input.RefreshToken)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(tokens)
+	}
+}
+
+// ForgotPassword emails a password reset link
+func (ctrl *AuthController) ForgotPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.ForgotPasswordInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.passwordResetService.RequestReset(input); err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{
+			"message": "If the email is registered, a reset link has been sent",
 		})
 	}
 }
+
+// ResetPassword sets a new password using a reset token
+func (ctrl *AuthController) ResetPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.ResetPasswordInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.passwordResetService.ResetPassword(input); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// Logout revokes the session the request was authenticated with
+func (ctrl *AuthController) Logout() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, err := middleware.CurrentSession(c)
+		if err != nil {
+			return err
+		}
+
+		if err := ctrl.authService.RevokeSession(session.UserID, session.ID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// GetSessions lists the active sessions of the current user
+func (ctrl *AuthController) GetSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, err := middleware.CurrentSession(c)
+		if err != nil {
+			return err
+		}
+
+		sessions, err := ctrl.authService.ListSessions(session.UserID)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"sessions":           sessions,
+			"current_session_id": strconv.FormatInt(session.ID, 10),
+		})
+	}
+}
+
+// RevokeSession logs out one of the current user's sessions
+func (ctrl *AuthController) RevokeSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, err := middleware.CurrentSession(c)
+		if err != nil {
+			return err
+		}
+
+		sessionID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid session ID")
+		}
+
+		if err := ctrl.authService.RevokeSession(session.UserID, sessionID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// RevokeAllSessions logs a user out of every device
+func (ctrl *AuthController) RevokeAllSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		if err := ctrl.authService.RevokeAllSessions(userID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// GetSessionPolicies lists the per-role session overrides
+func (ctrl *AuthController) GetSessionPolicies() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policies, err := ctrl.authService.GetSessionPolicies()
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(policies)
+	}
+}
+
+// SetSessionPolicy sets the session timeouts and limit of a role
+func (ctrl *AuthController) SetSessionPolicy() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.SessionPolicyInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.authService.SetSessionPolicy(c.Params("role"), input); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// UnlockAccount lifts a login lockout for a user
+func (ctrl *AuthController) UnlockAccount() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admin, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		if err := ctrl.authService.UnlockAccount(userID, admin.ID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// Impersonate starts a read-only session as another user for support staff
+func (ctrl *AuthController) Impersonate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admin, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		result, err := ctrl.authService.Impersonate(admin.ID, userID, clientInfo(c))
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(result)
+	}
+}
+
+// clientInfo captures the client details stored with a new session
+func clientInfo(c *fiber.Ctx) services.ClientInfo {
+	return services.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+type LecturerController struct {
+	lecturerService *services.LecturerService
+}
+
+func NewLecturerController(lecturerService *services.LecturerService) *LecturerController {
+	return &LecturerController{
+		lecturerService: lecturerService,
+	}
+}
+
+// GetLecturers lists lecturers; ?expertise= finds them by research area
+func (c *LecturerController) GetLecturers() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		query, err := parseListQuery(ctx, services.LecturerListSpec)
+		if err != nil {
+			return err
+		}
+
+		expertise := strings.TrimSpace(ctx.Query("expertise"))
+		if len(expertise) > 100 {
+			return fiber.NewError(fiber.StatusBadRequest, "Expertise query is too long")
+		}
+
+		response, err := c.lecturerService.GetLecturers(services.LecturerFilters{
+			Query:     query,
+			Expertise: expertise,
+		})
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(response)
+	}
+}
+
+func (c *LecturerController) GetLecturer() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid lecturer ID")
+		}
+
+		lecturer, err := c.lecturerService.GetLecturer(userID)
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(lecturer)
+	}
+}
+
+func (c *LecturerController) UpdateProfile() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid lecturer ID")
+		}
+
+		var input services.LecturerProfileInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		lecturer, err := c.lecturerService.UpdateProfile(userID, input)
+		if err != nil {
+			return userInputError(err, "Failed to update lecturer profile")
+		}
+
+		return ctx.JSON(lecturer)
+	}
+}
+
+// UpdateMyProfile lets lecturers edit their expertise, education and
+// whether they accept advisees
+func (c *LecturerController) UpdateMyProfile() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		current, err := middleware.CurrentUser(ctx)
+		if err != nil {
+			return err
+		}
+		if current.Role != models.RoleLecturer {
+			return fiber.NewError(fiber.StatusForbidden, "Only lecturers have a lecturer profile")
+		}
+
+		var input services.OwnLecturerProfileInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		lecturer, err := c.lecturerService.UpdateOwnProfile(current.ID, input)
+		if err != nil {
+			return userInputError(err, "Failed to update lecturer profile")
+		}
+
+		return ctx.JSON(lecturer)
+	}
+}
+
+// GetAdvisorCandidates lists the lecturers who can take another advisee,
+// optionally of ?department_code=
+func (c *LecturerController) GetAdvisorCandidates() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		candidates, err := c.lecturerService.AdvisorCandidates(ctx.Query("department_code"))
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(candidates)
+	}
+}
+
+// GetCourseCandidates lists the lecturers who can teach another class of a course
+func (c *LecturerController) GetCourseCandidates() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		courseID, err := strconv.ParseInt(ctx.Params("courseId"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid course ID")
+		}
+
+		candidates, err := c.lecturerService.CourseCandidates(courseID)
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(candidates)
+	}
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+type MetricsController struct{}
+
+func NewMetricsController() *MetricsController {
+	return &MetricsController{}
+}
+
+// GetCacheStats reports the hit rate of every Redis cache since this
+// instance started
+func (c *MetricsController) GetCacheStats() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(redis.CacheStats())
+	}
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+type NumberingController struct {
+	numberingService *services.NumberingService
+}
+
+func NewNumberingController(numberingService *services.NumberingService) *NumberingController {
+	return &NumberingController{
+		numberingService: numberingService,
+	}
+}
+
+func (c *NumberingController) GetRules() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		rules, err := c.numberingService.GetRules()
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(rules)
+	}
+}
+
+func (c *NumberingController) CreateRule() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var input services.NimNipRuleInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		rule, err := c.numberingService.CreateRule(input)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Status(http.StatusCreated).JSON(rule)
+	}
+}
+
+func (c *NumberingController) UpdateRule() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		ruleID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid rule ID")
+		}
+
+		var input services.NimNipRuleInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		rule, err := c.numberingService.UpdateRule(ruleID, input)
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(rule)
+	}
+}
+
+func (c *NumberingController) DeleteRule() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		ruleID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid rule ID")
+		}
+
+		if err := c.numberingService.DeleteRule(ruleID); err != nil {
+			return err
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so an
+// attacker cannot complete their own login in a victim's browser
+const oidcStateCookie = "ecampus_oidc_state"
+
+type OIDCController struct {
+	oidcService          *services.OIDCService
+	postLoginRedirectURL string
+	secureCookie         bool
+}
+
+func NewOIDCController(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config) *OIDCController {
+	authService := services.NewAuthService(db, redisClient, cfg)
+
+	return &OIDCController{
+		oidcService:          services.NewOIDCService(db, redisClient, cfg, authService),
+		postLoginRedirectURL: cfg.OIDC.PostLoginRedirectURL,
+		secureCookie:         strings.HasPrefix(cfg.OIDC.RedirectURL, "https://"),
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (ctrl *OIDCController) Login() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authURL, state, err := ctrl.oidcService.AuthorizationURL(c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		ctrl.setStateCookie(c, state, time.Now().Add(constants.App.OIDCStateExpiration))
+
+		return c.Redirect(authURL, http.StatusFound)
+	}
+}
+
+// Callback finishes the login started by Login
+func (ctrl *OIDCController) Callback() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if errCode := c.Query("error"); errCode != "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "Single sign-on failed: "+errCode)
+		}
+
+		// The state is single use, whatever the outcome
+		boundState := c.Cookies(oidcStateCookie)
+		ctrl.setStateCookie(c, "", time.Unix(0, 0))
+
+		result, err := ctrl.oidcService.HandleCallback(c.UserContext(), c.Query("code"), c.Query("state"), boundState, clientInfo(c))
+		if err != nil {
+			return err
+		}
+
+		if ctrl.postLoginRedirectURL == "" {
+			return c.Status(http.StatusOK).JSON(result)
+		}
+
+		// Tokens go in the fragment so they never reach server logs
+		fragment := url.Values{}
+		if result.AuthTokens != nil {
+			fragment.Set("access_token", result.AccessToken)
+			fragment.Set("refresh_token", result.RefreshToken)
+			fragment.Set("expires_in", strconv.FormatInt(result.ExpiresIn, 10))
+		}
+		if result.TwoFactorRequired {
+			fragment.Set("two_factor_required", "true")
+			fragment.Set("two_factor_setup_required", strconv.FormatBool(result.TwoFactorSetupRequired))
+			fragment.Set("challenge_token", result.ChallengeToken)
+		}
+
+		return c.Redirect(ctrl.postLoginRedirectURL+"#"+fragment.Encode(), http.StatusFound)
+	}
+}
+
+// setStateCookie stores the state for the callback only. SameSite=Lax still
+// sends it on the top-level redirect back from the IdP.
+func (ctrl *OIDCController) setStateCookie(c *fiber.Ctx, state string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  expires,
+		Secure:   ctrl.secureCookie,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
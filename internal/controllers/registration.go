@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+type RegistrationController struct {
+	registrationService *services.RegistrationService
+}
+
+func NewRegistrationController(registrationService *services.RegistrationService) *RegistrationController {
+	return &RegistrationController{
+		registrationService: registrationService,
+	}
+}
+
+// Register signs up an admitted student and sends the verification email
+func (ctrl *RegistrationController) Register() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.RegisterUserInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		registration, err := ctrl.registrationService.Register(input)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(registration)
+	}
+}
+
+func (ctrl *RegistrationController) VerifyEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.VerifyEmailInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.registrationService.VerifyEmail(input); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// ResendVerification always answers 202 so it cannot be used to probe accounts
+func (ctrl *RegistrationController) ResendVerification() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.ResendVerificationInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.registrationService.ResendVerification(input); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusAccepted)
+	}
+}
+
+func (ctrl *RegistrationController) GetRegistrations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query, err := parseListQuery(c, services.RegistrationListSpec)
+		if err != nil {
+			return err
+		}
+
+		registrations, err := ctrl.registrationService.GetRegistrations(c.Query("state"), query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(registrations)
+	}
+}
+
+func (ctrl *RegistrationController) Approve() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return ctrl.review(c, ctrl.registrationService.Approve)
+	}
+}
+
+func (ctrl *RegistrationController) Reject() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return ctrl.review(c, ctrl.registrationService.Reject)
+	}
+}
+
+func (ctrl *RegistrationController) review(c *fiber.Ctx, decide func(userID, adminID int64) error) error {
+	admin, err := middleware.CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := decide(userID, admin.ID); err != nil {
+		return err
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (ctrl *RegistrationController) GetAdmissions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query, err := parseListQuery(c, services.AdmissionListSpec)
+		if err != nil {
+			return err
+		}
+
+		admissions, err := ctrl.registrationService.GetAdmissions(query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(admissions)
+	}
+}
+
+// ImportAdmissions loads a batch of admitted students
+func (ctrl *RegistrationController) ImportAdmissions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var inputs []services.AdmissionInput
+		if err := c.BodyParser(&inputs); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		imported, err := ctrl.registrationService.ImportAdmissions(inputs)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"imported": imported,
+		})
+	}
+}
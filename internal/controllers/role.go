@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+type RoleController struct {
+	roleService *services.RoleService
+}
+
+func NewRoleController(roleService *services.RoleService) *RoleController {
+	return &RoleController{
+		roleService: roleService,
+	}
+}
+
+func (c *RoleController) GetPermissions() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		permissions, err := c.roleService.GetPermissions()
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(permissions)
+	}
+}
+
+func (c *RoleController) GetRoles() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		roles, err := c.roleService.GetRoles()
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(roles)
+	}
+}
+
+func (c *RoleController) GetRole() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		role, err := c.roleService.GetRole(ctx.Params("name"))
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(role)
+	}
+}
+
+func (c *RoleController) CreateRole() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var input services.RoleInput
+		if err := ctx.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		role, err := c.roleService.CreateRole(input)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Status(http.StatusCreated).JSON(role)
+	}
+}
+
+// UpdateRole replaces a role's description and permissions
+func (c *RoleController) UpdateRole() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var input services.RoleInput
+		if err := ctx.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		role, err := c.roleService.UpdateRole(ctx.Params("name"), input)
+		if err != nil {
+			return err
+		}
+
+		return ctx.JSON(role)
+	}
+}
+
+func (c *RoleController) DeleteRole() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := c.roleService.DeleteRole(ctx.Params("name")); err != nil {
+			return err
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+type ServiceAccountController struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewServiceAccountController(apiKeyService *services.APIKeyService) *ServiceAccountController {
+	return &ServiceAccountController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (c *ServiceAccountController) GetServiceAccounts() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accounts, err := c.apiKeyService.GetServiceAccounts()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch service accounts")
+		}
+
+		return ctx.JSON(accounts)
+	}
+}
+
+func (c *ServiceAccountController) GetServiceAccount() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accountID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid service account ID")
+		}
+
+		account, err := c.apiKeyService.GetServiceAccount(accountID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fiber.NewError(fiber.StatusNotFound, "Service account not found")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch service account")
+		}
+
+		return ctx.JSON(account)
+	}
+}
+
+func (c *ServiceAccountController) CreateServiceAccount() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		admin, err := middleware.CurrentUser(ctx)
+		if err != nil {
+			return err
+		}
+
+		var input services.ServiceAccountInput
+		if err := ctx.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		account, err := c.apiKeyService.CreateServiceAccount(input, admin.ID)
+		if err != nil {
+			return err
+		}
+
+		return ctx.Status(http.StatusCreated).JSON(account)
+	}
+}
+
+func (c *ServiceAccountController) DisableServiceAccount() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accountID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid service account ID")
+		}
+
+		if err := c.apiKeyService.DisableServiceAccount(accountID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fiber.NewError(fiber.StatusNotFound, "Service account not found")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to disable service account")
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
+
+// CreateAPIKey issues a key; the plain key is only included in this response
+func (c *ServiceAccountController) CreateAPIKey() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accountID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid service account ID")
+		}
+
+		var input services.APIKeyInput
+		if err := ctx.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		key, err := c.apiKeyService.CreateAPIKey(accountID, input)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fiber.NewError(fiber.StatusNotFound, "Service account not found")
+			}
+			return err
+		}
+
+		return ctx.Status(http.StatusCreated).JSON(key)
+	}
+}
+
+func (c *ServiceAccountController) RevokeAPIKey() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accountID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid service account ID")
+		}
+
+		keyID, err := strconv.ParseInt(ctx.Params("keyId"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid API key ID")
+		}
+
+		if err := c.apiKeyService.RevokeAPIKey(accountID, keyID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fiber.NewError(fiber.StatusNotFound, "API key not found")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke API key")
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
+
+// GetRequests returns the audit log of requests made with the account's keys
+func (c *ServiceAccountController) GetRequests() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		accountID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid service account ID")
+		}
+
+		query, err := parseListQuery(ctx, services.APIKeyRequestListSpec)
+		if err != nil {
+			return err
+		}
+
+		requests, err := c.apiKeyService.GetRequests(accountID, query)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch requests")
+		}
+
+		return ctx.JSON(requests)
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+type TwoFactorController struct {
+	twoFactorService *services.TwoFactorService
+}
+
+func NewTwoFactorController(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config) *TwoFactorController {
+	authService := services.NewAuthService(db, redisClient, cfg)
+
+	return &TwoFactorController{
+		twoFactorService: services.NewTwoFactorService(db, redisClient, cfg, authService),
+	}
+}
+
+// VerifyChallenge completes a login with a TOTP or recovery code
+func (ctrl *TwoFactorController) VerifyChallenge() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.TwoFactorCodeInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		tokens, err := ctrl.twoFactorService.VerifyChallenge(input, clientInfo(c))
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(tokens)
+	}
+}
+
+// SetupChallenge starts enrollment for users whose role requires 2FA
+func (ctrl *TwoFactorController) SetupChallenge() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.TwoFactorCodeInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		setup, err := ctrl.twoFactorService.SetupWithChallenge(input.ChallengeToken)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(setup)
+	}
+}
+
+// EnableChallenge finishes enrollment during login and returns a session
+func (ctrl *TwoFactorController) EnableChallenge() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.TwoFactorCodeInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		enrollment, err := ctrl.twoFactorService.EnableWithChallenge(input, clientInfo(c))
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(enrollment)
+	}
+}
+
+// Setup starts enrollment for the current user
+func (ctrl *TwoFactorController) Setup() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		setup, err := ctrl.twoFactorService.Setup(user.ID, user.Email)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(setup)
+	}
+}
+
+// Enable verifies the first code and returns recovery codes
+func (ctrl *TwoFactorController) Enable() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		var input services.TwoFactorCodeInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		codes, err := ctrl.twoFactorService.Enable(user.ID, input.Code)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(fiber.Map{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// Disable turns 2FA off for the current user
+func (ctrl *TwoFactorController) Disable() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		var input services.TwoFactorCodeInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.twoFactorService.Disable(user, input.Code); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (ctrl *TwoFactorController) RegenerateRecoveryCodes() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		var input services.TwoFactorCodeInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		codes, err := ctrl.twoFactorService.RegenerateRecoveryCodes(user.ID, input.Code)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(fiber.Map{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// GetPolicies lists the roles for which 2FA is mandatory
+func (ctrl *TwoFactorController) GetPolicies() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policies, err := ctrl.twoFactorService.GetPolicies()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch policies")
+		}
+
+		return c.JSON(policies)
+	}
+}
+
+// SetPolicy makes 2FA mandatory or optional for a role
+func (ctrl *TwoFactorController) SetPolicy() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.TwoFactorPolicyInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		if err := ctrl.twoFactorService.SetPolicy(c.Params("role"), input.Required); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
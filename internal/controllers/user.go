@@ -1,59 +1,153 @@
 package controllers
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
 	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/listquery"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type UserController struct {
-	userService *services.UserService
+	userService     *services.UserService
+	passwordService *services.PasswordService
+	importService   *services.UserImportService
+	photoService    *services.PhotoService
 }
 
-func NewUserController(userService *services.UserService) *UserController {
+func NewUserController(userService *services.UserService, passwordService *services.PasswordService, importService *services.UserImportService, photoService *services.PhotoService) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:     userService,
+		passwordService: passwordService,
+		importService:   importService,
+		photoService:    photoService,
 	}
 }
 
 func (c *UserController) GetUsers() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		limit := ctx.QueryInt("limit", 10)
-		page := ctx.QueryInt("page", 1)
-		offset := (page - 1) * limit
-
-		// Parse filters from query parameters
-		filters := make(map[string]interface{})
-		if role := ctx.Query("role"); role != "" {
-			filters["role"] = role
+		params, err := userFilters(ctx)
+		if err != nil {
+			return err
 		}
-		if status := ctx.Query("status"); status != "" {
-			filters["status"] = status
+
+		response, err := c.userService.GetUsers(params)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
 		}
-		if dept := ctx.Query("department_code"); dept != "" {
-			filters["department_code"] = dept
+
+		for i := range response.Users {
+			if err := c.photoService.Resolve(ctx.Context(), &response.Users[i]); err != nil {
+				return err
+			}
 		}
 
-		params := services.UserFilters{
-			Limit:   limit,
-			Offset:  offset,
-			Filters: filters,
+		return ctx.JSON(response)
+	}
+}
+
+// ExportUsers streams the users matching the GetUsers filters as CSV or XLSX
+func (c *UserController) ExportUsers() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		params, err := userFilters(ctx)
+		if err != nil {
+			return err
 		}
 
-		response, err := c.userService.GetUsers(params)
+		columns, err := services.ExportColumns(ctx.Query("columns"))
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch users")
+			return err
 		}
 
-		return ctx.JSON(response)
+		format := ctx.Query("format", services.ExportFormatCSV)
+		switch format {
+		case services.ExportFormatCSV:
+			ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		case services.ExportFormatXLSX:
+			ctx.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "Format must be csv or xlsx")
+		}
+		ctx.Attachment(fmt.Sprintf("users-%s.%s", time.Now().Format("20060102-150405"), format))
+
+		// The body is written after the handler returns; a failure midway
+		// truncates the file since the status has already been sent
+		userService, photoService := c.userService, c.photoService
+		ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			_ = userService.ExportUsers(context.Background(), w, format, params, columns, photoService)
+		})
+
+		return nil
 	}
 }
 
+// userFilters parses the list query shared by GetUsers and ExportUsers, see
+// services.UserListSpec for the fields it accepts
+func userFilters(ctx *fiber.Ctx) (services.UserFilters, error) {
+	query, err := parseListQuery(ctx, services.UserListSpec)
+	if err != nil {
+		return services.UserFilters{}, err
+	}
+
+	search := strings.TrimSpace(ctx.Query("q"))
+	if len(search) > 100 {
+		return services.UserFilters{}, fiber.NewError(fiber.StatusBadRequest, "Search query is too long")
+	}
+	if search != "" && !query.Sorted && query.HasCursor() {
+		return services.UserFilters{}, fiber.NewError(fiber.StatusBadRequest, "Search results ranked by relevance are paged with page, not cursor")
+	}
+
+	// Deleted users are only listed for callers who may delete users
+	includeDeleted := ctx.QueryBool("include_deleted")
+	if includeDeleted {
+		principal, ok := middleware.GetPrincipal(ctx)
+		if !ok || !principal.Can(constants.Permissions.UsersDelete) {
+			return services.UserFilters{}, fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
+		}
+	}
+
+	return services.UserFilters{
+		Query:          query,
+		IncludeDeleted: includeDeleted,
+		Search:         search,
+	}, nil
+}
+
 func (c *UserController) GetCurrentUser() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		user := ctx.Locals("userData")
+		principal, ok := middleware.GetPrincipal(ctx)
+		if !ok {
+			return fiber.NewError(fiber.StatusUnauthorized, "User data not found")
+		}
+
+		if principal.APIKey != nil {
+			return ctx.JSON(principal.APIKey)
+		}
+
+		// Resolve a copy so the cached principal keeps the stored photo key
+		user := *principal.User
+		if err := c.photoService.Resolve(ctx.Context(), &user.BaseUser); err != nil {
+			return err
+		}
+
+		if impersonatorID := principal.Session.ImpersonatorID; impersonatorID != nil {
+			return ctx.JSON(struct {
+				*services.UserDetails
+				ImpersonatedBy int64 `json:"impersonated_by"`
+			}{&user, *impersonatorID})
+		}
 
 		return ctx.JSON(user)
 	}
@@ -61,47 +155,319 @@ func (c *UserController) GetCurrentUser() fiber.Handler {
 
 func (c *UserController) CreateUser() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		var user models.User
-		if err := ctx.BodyParser(&user); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		var input services.CreateUserInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
 		}
 
-		if err := c.userService.CreateUser(&user); err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		if input.Password != "" {
+			hashed, err := c.hashPassword(input.Password)
+			if err != nil {
+				return err
+			}
+			input.Password = hashed
+		}
+
+		user, err := c.userService.CreateUser(input)
+		if err != nil {
+			return userInputError(err, "Failed to create user")
 		}
 
 		return ctx.Status(http.StatusCreated).JSON(user)
 	}
 }
 
+// ImportUsers creates users from an uploaded CSV or XLSX file. With dry_run
+// the file is only validated.
+func (c *UserController) ImportUsers() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		header, err := ctx.FormFile("file")
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "File is required")
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Failed to read file")
+		}
+		defer file.Close()
+
+		rows, err := services.ParseUserImport(header.Filename, file)
+		if err != nil {
+			return err
+		}
+
+		report, err := c.importService.Import(rows, ctx.QueryBool("dry_run"))
+		if err != nil {
+			return err
+		}
+
+		status := http.StatusOK
+		switch {
+		case report.Invalid > 0:
+			status = http.StatusUnprocessableEntity
+		case report.Created > 0:
+			status = http.StatusCreated
+		}
+
+		return ctx.Status(status).JSON(report)
+	}
+}
+
 func (c *UserController) UpdateUser() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		userID := ctx.Params("id")
-		if userID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "User ID is required")
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
 		}
 
-		updates := make(map[string]interface{})
-		if err := ctx.BodyParser(&updates); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		var input services.UpdateUserInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
 		}
 
-		if err := c.userService.UpdateUser(userID, updates); err != nil {
-			if err == sql.ErrNoRows {
-				return fiber.NewError(fiber.StatusNotFound, "User not found")
+		if input.Password != nil {
+			hashed, err := c.hashPassword(*input.Password)
+			if err != nil {
+				return err
 			}
-			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			input.Password = &hashed
+		}
+
+		if err := c.userService.UpdateUser(userID, input); err != nil {
+			return userInputError(err, "Failed to update user")
 		}
 
 		return ctx.SendStatus(http.StatusOK)
 	}
 }
 
+// UpdateCurrentUser lets users edit their own profile fields
+func (c *UserController) UpdateCurrentUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		current, err := middleware.CurrentUser(ctx)
+		if err != nil {
+			return err
+		}
+
+		var input services.UpdateProfileInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		if err := c.userService.UpdateProfile(current.ID, input); err != nil {
+			return userInputError(err, "Failed to update profile")
+		}
+
+		user, err := c.userService.GetUserByID(current.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch user")
+		}
+		if err := c.photoService.Resolve(ctx.Context(), &user.BaseUser); err != nil {
+			return err
+		}
+
+		return ctx.JSON(user)
+	}
+}
+
+// hashPassword hashes a new password, reporting policy violations as a field error
+func (c *UserController) hashPassword(password string) (string, error) {
+	hashed, err := c.passwordService.Hash(password)
+	if err != nil {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusBadRequest {
+			return "", services.FieldErrors{"password": fiberErr.Message}
+		}
+		return "", err
+	}
+
+	return hashed, nil
+}
+
+// parseListQuery reads the filters, sort and pagination of a list endpoint
+func parseListQuery[T any](ctx *fiber.Ctx, spec listquery.Spec[T]) (listquery.Query, error) {
+	values, err := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	if err != nil {
+		return listquery.Query{}, fiber.NewError(fiber.StatusBadRequest, "Invalid query string")
+	}
+
+	query, err := spec.Parse(values)
+	if err != nil {
+		return listquery.Query{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return query, nil
+}
+
+// parseBody decodes a JSON body, reporting values of the wrong type as field errors
+func parseBody(ctx *fiber.Ctx, out interface{}) error {
+	if err := ctx.BodyParser(out); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return services.FieldErrors{typeErr.Field: "must be a " + typeErr.Type.String()}
+		}
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	return nil
+}
+
+// userInputError passes validation and HTTP errors through and hides the rest
+func userInputError(err error, message string) error {
+	var fields services.FieldErrors
+	var fiberErr *fiber.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fiber.NewError(fiber.StatusNotFound, "User not found")
+	case errors.As(err, &fields), errors.As(err, &fiberErr):
+		return err
+	default:
+		return fiber.NewError(fiber.StatusInternalServerError, message)
+	}
+}
+
+// ChangeUserStatus moves a user to another status, see UserService.ChangeStatus
+func (c *UserController) ChangeUserStatus() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		var input services.StatusChangeInput
+		if err := parseBody(ctx, &input); err != nil {
+			return err
+		}
+
+		// API keys change statuses without an actor
+		var actorID *int64
+		if principal, ok := middleware.GetPrincipal(ctx); ok && principal.User != nil {
+			actorID = &principal.User.ID
+		}
+
+		change, err := c.userService.ChangeStatus(userID, input, actorID)
+		if err != nil {
+			return userInputError(err, "Failed to change status")
+		}
+
+		return ctx.Status(http.StatusCreated).JSON(change)
+	}
+}
+
+func (c *UserController) GetStatusHistory() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		history, err := c.userService.GetStatusHistory(userID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch status history")
+		}
+
+		return ctx.JSON(history)
+	}
+}
+
+// GetAcademicYearActivity reports whether a user was active during the
+// academic year period given by ?academic_year_id=
+func (c *UserController) GetAcademicYearActivity() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		academicYearID, err := strconv.ParseInt(ctx.Query("academic_year_id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "academic_year_id must be the ID of an academic year")
+		}
+
+		academicYear, err := c.userService.GetAcademicYear(academicYearID)
+		if err != nil {
+			return userInputError(err, "Failed to fetch academic year")
+		}
+
+		active, err := c.userService.WasActiveDuring(userID, academicYear)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check status history")
+		}
+
+		return ctx.JSON(fiber.Map{
+			"academic_year_id": academicYear.ID,
+			"year":             academicYear.Year,
+			"semester":         academicYear.Semester,
+			"starts":           academicYear.StartDate.Format(time.DateOnly),
+			"ends":             academicYear.EndDate.Format(time.DateOnly),
+			"active":           active,
+		})
+	}
+}
+
+// UploadMyPhoto replaces the signed-in user's profile photo
+func (c *UserController) UploadMyPhoto() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(ctx)
+		if err != nil {
+			return err
+		}
+
+		return c.uploadPhoto(ctx, user.ID)
+	}
+}
+
+// UploadUserPhoto replaces the profile photo of any user
+func (c *UserController) UploadUserPhoto() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		return c.uploadPhoto(ctx, userID)
+	}
+}
+
+// uploadPhoto reads the "photo" form file and stores it for the user
+func (c *UserController) uploadPhoto(ctx *fiber.Ctx, userID int64) error {
+	header, err := ctx.FormFile("photo")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Photo is required")
+	}
+	if header.Size > int64(constants.App.PhotoMaxSize) {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Photo must not be larger than %d MiB", constants.App.PhotoMaxSize>>20))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read photo")
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so the service can reject oversized files
+	data, err := io.ReadAll(io.LimitReader(file, int64(constants.App.PhotoMaxSize)+1))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to read photo")
+	}
+
+	user, err := c.photoService.Upload(ctx.Context(), userID, data)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"photo_url": user.PhotoURL,
+		"photos":    user.Photos,
+	})
+}
+
 func (c *UserController) DeleteUser() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		userID := ctx.Params("id")
-		if userID == "" {
-			return fiber.NewError(fiber.StatusBadRequest, "User ID is required")
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
 		}
 
 		if err := c.userService.DeleteUser(userID); err != nil {
@@ -111,6 +477,55 @@ func (c *UserController) DeleteUser() fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete user")
 		}
 
+		// Photos are publicly reachable, so they do not outlive the account
+		if err := c.photoService.RemoveDeleted(userID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete user photo")
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
+
+func (c *UserController) RestoreUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		if err := c.userService.RestoreUser(userID); err != nil {
+			if err == sql.ErrNoRows {
+				return fiber.NewError(fiber.StatusNotFound, "Deleted user not found")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to restore user")
+		}
+
+		return ctx.SendStatus(http.StatusNoContent)
+	}
+}
+
+func (c *UserController) PurgeUser() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		// Users deleted before photos were removed on delete may still have one
+		if err := c.photoService.RemoveDeleted(userID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete user photo")
+		}
+
+		if err := c.userService.PurgeUser(userID); err != nil {
+			if err == sql.ErrNoRows {
+				return fiber.NewError(fiber.StatusNotFound, "User not found")
+			}
+			if errors.Is(err, services.ErrUserNotDeleted) {
+				return fiber.NewError(fiber.StatusConflict, err.Error())
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to purge user")
+		}
+
 		return ctx.SendStatus(http.StatusNoContent)
 	}
 }
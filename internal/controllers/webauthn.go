@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+// BeginWebAuthnLogin returns the assertion options for a passkey login
+func (ctrl *AuthController) BeginWebAuthnLogin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.WebAuthnLoginInput
+
+		// The body is optional for discoverable logins
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&input); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+			}
+		}
+
+		ceremony, err := ctrl.webAuthnService.BeginLogin(input)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(ceremony)
+	}
+}
+
+// FinishWebAuthnLogin verifies the assertion and issues a session
+func (ctrl *AuthController) FinishWebAuthnLogin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var input services.WebAuthnFinishInput
+
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		tokens, err := ctrl.webAuthnService.FinishLogin(input, clientInfo(c))
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(tokens)
+	}
+}
+
+// BeginWebAuthnRegistration returns the creation options for a new authenticator
+func (ctrl *AuthController) BeginWebAuthnRegistration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		ceremony, err := ctrl.webAuthnService.BeginRegistration(user.ID)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(ceremony)
+	}
+}
+
+// FinishWebAuthnRegistration stores the authenticator created by the client
+func (ctrl *AuthController) FinishWebAuthnRegistration() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		var input services.WebAuthnFinishInput
+		if err := c.BodyParser(&input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+		}
+
+		credential, err := ctrl.webAuthnService.FinishRegistration(user.ID, input)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(credential)
+	}
+}
+
+// GetWebAuthnCredentials lists the current user's authenticators
+func (ctrl *AuthController) GetWebAuthnCredentials() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		credentials, err := ctrl.webAuthnService.GetCredentials(user.ID)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(credentials)
+	}
+}
+
+// DeleteWebAuthnCredential removes one of the current user's authenticators
+func (ctrl *AuthController) DeleteWebAuthnCredential() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := middleware.CurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		credentialID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid credential ID")
+		}
+
+		if err := ctrl.webAuthnService.DeleteCredential(user.ID, credentialID); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,6 +15,19 @@ const (
 	RoleAdmin    Role = "admin"
 )
 
+// User statuses. Changes after creation follow the transitions allowed by
+// UserService.ChangeStatus and are recorded in user_status_history.
+const (
+	UserStatusActive              = "active"
+	UserStatusPendingVerification = "pending_verification" // Self-registered, email not yet verified
+	UserStatusRejected            = "rejected"             // Registration rejected by an admin
+	UserStatusOnLeave             = "on_leave"
+	UserStatusSuspended           = "suspended" // Cannot log in
+	UserStatusGraduated           = "graduated"
+	UserStatusDroppedOut          = "dropped_out" // Cannot log in
+	UserStatusTransferred         = "transferred" // Moved to another institution, cannot log in
+)
+
 // Department represents an academic department
 type Department struct {
 	Name        string    `db:"name" json:"name"`
@@ -47,12 +63,16 @@ type BaseUser struct {
 	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
 	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at,omitempty"` // Added soft delete
+	PurgedAt       *time.Time `db:"purged_at" json:"purged_at,omitempty"`   // Personal data removed, see UserService.PurgeUser
+
+	// Photos holds the URL of every photo size, see PhotoService.Resolve
+	Photos map[string]string `db:"-" json:"photos,omitempty"`
 }
 
 // User represents any user in the system (student, lecturer, admin)
 type User struct {
 	BaseUser        // Embeds BaseUser, inheriting all its fields
-	Password string `db:"password" json:"password"` // Only added to User struct
+	Password string `db:"password" json:"-"` // Only added to User struct, never serialized
 }
 
 // Course represents an academic course
@@ -158,3 +178,237 @@ type Attendance struct {
 	CreatedAt       time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
 }
+
+// RoleDefinition is a row of the roles table. Permissions is loaded from
+// role_permissions and is not a column.
+type RoleDefinition struct {
+	Name        Role      `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	IsSystem    bool      `db:"is_system" json:"is_system"` // Built-in roles cannot be deleted
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	Permissions []string  `db:"-" json:"permissions"`
+}
+
+// Permission is an action that can be granted to roles and API keys
+type Permission struct {
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+}
+
+// Admission is an entry of the admission list that students register against
+type Admission struct {
+	ID             int64     `db:"id" json:"id" goqu:"skipinsert"`
+	NimNip         string    `db:"nim_nip" json:"nim_nip"`
+	Email          string    `db:"email" json:"email"`
+	Name           string    `db:"name" json:"name"`
+	DepartmentCode *string   `db:"department_code" json:"department_code,omitempty"`
+	EntryYear      *int      `db:"entry_year" json:"entry_year,omitempty"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type RegistrationDecision string
+
+const (
+	RegistrationApproved RegistrationDecision = "approved"
+	RegistrationRejected RegistrationDecision = "rejected"
+)
+
+// Registration tracks a self-service sign up from the admission list until
+// the email is verified or an admin decides on it
+type Registration struct {
+	UserID                int64                 `db:"user_id" json:"user_id"`
+	AdmissionID           int64                 `db:"admission_id" json:"admission_id"`
+	VerificationExpiresAt time.Time             `db:"verification_expires_at" json:"verification_expires_at"`
+	VerifiedAt            *time.Time            `db:"verified_at" json:"verified_at,omitempty"`
+	Decision              *RegistrationDecision `db:"decision" json:"decision,omitempty"`
+	ReviewedBy            *int64                `db:"reviewed_by" json:"reviewed_by,omitempty"`
+	ReviewedAt            *time.Time            `db:"reviewed_at" json:"reviewed_at,omitempty"`
+	CreatedAt             time.Time             `db:"created_at" json:"created_at"`
+}
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID           int64      `db:"id" json:"id" goqu:"skipinsert"`
+	UserID       int64      `db:"user_id" json:"user_id"`
+	CredentialID []byte     `db:"credential_id" json:"-"`
+	Name         string     `db:"name" json:"name"`
+	Credential   []byte     `db:"credential" json:"-"` // webauthn.Credential as JSON
+	LastUsedAt   *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// UserTwoFactor holds a user's TOTP enrollment; EnabledAt stays nil until the first code is verified
+type UserTwoFactor struct {
+	UserID       int64      `db:"user_id" json:"user_id"`
+	Secret       string     `db:"secret" json:"-"` // Encrypted with the data keyring
+	EnabledAt    *time.Time `db:"enabled_at" json:"enabled_at,omitempty"`
+	LastUsedStep int64      `db:"last_used_step" json:"-"` // Guards against code replay
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// TwoFactorPolicy marks two-factor authentication as mandatory for a role
+type TwoFactorPolicy struct {
+	Role      Role      `db:"role" json:"role"`
+	Required  bool      `db:"required" json:"required"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// SessionPolicy overrides the configured session lifetimes for a role. Null
+// columns fall back to the configured defaults.
+type SessionPolicy struct {
+	Role                   Role      `db:"role" json:"role"`
+	IdleTimeoutSeconds     *int      `db:"idle_timeout_seconds" json:"idle_timeout_seconds"`
+	AbsoluteTimeoutSeconds *int      `db:"absolute_timeout_seconds" json:"absolute_timeout_seconds"`
+	MaxSessions            *int      `db:"max_sessions" json:"max_sessions"` // 0 disables the limit
+	UpdatedAt              time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// NimNipRule generates the NIM/NIP of new users of a role. A rule without a
+// department is the default for the role.
+type NimNipRule struct {
+	ID             int64     `db:"id" json:"id" goqu:"skipinsert"`
+	Role           Role      `db:"role" json:"role"`
+	DepartmentCode *string   `db:"department_code" json:"department_code"`
+	Template       string    `db:"template" json:"template"` // e.g. "{yy}{dept}{seq:4}"
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// UserStatusChange is an entry of a user's status history. A status holds
+// from its effective date until the effective date of the next entry.
+type UserStatusChange struct {
+	ID            int64     `db:"id" json:"id" goqu:"skipinsert"`
+	UserID        int64     `db:"user_id" json:"user_id"`
+	FromStatus    *string   `db:"from_status" json:"from_status"` // Null for the first entry
+	ToStatus      string    `db:"to_status" json:"to_status"`
+	Reason        *string   `db:"reason" json:"reason,omitempty"`
+	EffectiveDate time.Time `db:"effective_date" json:"effective_date"`
+	ActorID       *int64    `db:"actor_id" json:"actor_id,omitempty"` // Null for system changes
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// Academic ranks (jabatan fungsional) of lecturers, lowest first
+const (
+	AcademicRankAssistant      = "asisten_ahli"
+	AcademicRankLecturer       = "lektor"
+	AcademicRankSeniorLecturer = "lektor_kepala"
+	AcademicRankProfessor      = "guru_besar"
+)
+
+// LecturerProfile extends the user of a lecturer with their academic record
+// and the capacity used when assigning advisees and classes
+type LecturerProfile struct {
+	UserID             int64     `db:"user_id" json:"user_id"`
+	Nidn               *string   `db:"nidn" json:"nidn"` // Nomor Induk Dosen Nasional, 10 digits
+	AcademicRank       *string   `db:"academic_rank" json:"academic_rank"`
+	AcceptingAdvisees  bool      `db:"accepting_advisees" json:"accepting_advisees"`
+	MaxAdvisees        int       `db:"max_advisees" json:"max_advisees"`                 // Per active academic year
+	MaxTeachingCredits int       `db:"max_teaching_credits" json:"max_teaching_credits"` // Per active academic year
+	CreatedAt          time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time `db:"updated_at" json:"updated_at"`
+
+	Expertise []string            `db:"-" json:"expertise"`           // Research areas
+	Education []LecturerEducation `db:"-" json:"education,omitempty"` // Only loaded for a single lecturer
+}
+
+// LecturerEducation is a degree held by a lecturer
+type LecturerEducation struct {
+	ID             int64  `db:"id" json:"id" goqu:"skipinsert"`
+	UserID         int64  `db:"user_id" json:"-"`
+	Degree         string `db:"degree" json:"degree"` // bachelor/master/doctorate/professional
+	Field          string `db:"field" json:"field"`
+	Institution    string `db:"institution" json:"institution"`
+	GraduationYear *int   `db:"graduation_year" json:"graduation_year,omitempty"`
+}
+
+type SecurityEventType string
+
+const (
+	SecurityEventLoginFailed          SecurityEventType = "login_failed"
+	SecurityEventAccountLocked        SecurityEventType = "account_locked"
+	SecurityEventAccountUnlocked      SecurityEventType = "account_unlocked"
+	SecurityEventImpersonationStarted SecurityEventType = "impersonation_started"
+	SecurityEventImpersonatedRequest  SecurityEventType = "impersonated_request"
+	SecurityEventSessionEvicted       SecurityEventType = "session_evicted"
+)
+
+// SecurityEvent is an append-only audit record of authentication activity
+type SecurityEvent struct {
+	ID        int64             `db:"id" json:"id" goqu:"skipinsert"`
+	EventType SecurityEventType `db:"event_type" json:"event_type"`
+	UserID    *int64            `db:"user_id" json:"user_id,omitempty"`
+	ActorID   *int64            `db:"actor_id" json:"actor_id,omitempty"` // Admin who triggered the event
+	Email     string            `db:"email" json:"email,omitempty"`
+	IP        string            `db:"ip" json:"ip,omitempty"`
+	UserAgent string            `db:"user_agent" json:"user_agent,omitempty"`
+	Details   string            `db:"details" json:"details,omitempty"`
+	CreatedAt time.Time         `db:"created_at" json:"created_at"`
+}
+
+// ServiceAccount is a non-human principal used by integrations such as the library or payment system
+type ServiceAccount struct {
+	ID          int64      `db:"id" json:"id" goqu:"skipinsert"`
+	Name        string     `db:"name" json:"name"`
+	Description string     `db:"description" json:"description,omitempty"`
+	CreatedBy   *int64     `db:"created_by" json:"created_by,omitempty"`
+	DisabledAt  *time.Time `db:"disabled_at" json:"disabled_at,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Scopes is a list of granted scopes, stored as a space separated string
+type Scopes []string
+
+func (s Scopes) Has(scope string) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *Scopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", src)
+	}
+	return nil
+}
+
+// APIKey belongs to a service account; only the SHA-256 hash of the key is stored
+type APIKey struct {
+	ID               int64      `db:"id" json:"id" goqu:"skipinsert"`
+	ServiceAccountID int64      `db:"service_account_id" json:"service_account_id"`
+	Prefix           string     `db:"prefix" json:"prefix"` // Public part of the key, used for lookup
+	KeyHash          string     `db:"key_hash" json:"-"`
+	Scopes           Scopes     `db:"scopes" json:"scopes"`
+	ExpiresAt        time.Time  `db:"expires_at" json:"expires_at"`
+	LastUsedAt       *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+}
+
+// APIKeyRequest is the audit record written for every request made with an API key
+type APIKeyRequest struct {
+	ID        int64     `db:"id" json:"id" goqu:"skipinsert"`
+	APIKeyID  int64     `db:"api_key_id" json:"api_key_id"`
+	Method    string    `db:"method" json:"method"`
+	Path      string    `db:"path" json:"path"`
+	Status    int       `db:"status" json:"status"`
+	IP        string    `db:"ip" json:"ip"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -4,20 +4,27 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/rafaalrazzak/e-campus-be/internal/routes"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/storage"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"strings"
 )
 
-func NewFiberApp(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config) *fiber.App {
+func NewFiberApp(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, mail mailer.Mailer, store storage.Storage) *fiber.App {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
+		// Room for photo uploads, see constants.App.PhotoMaxSize
+		BodyLimit: 16 << 20,
 	})
 
 	// Logger middleware
@@ -27,7 +34,12 @@ func NewFiberApp(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg
 		TimeZone:   "Local",
 	}))
 
-	routes.SetupRoutes(app, db, redisClient, cfg)
+	// Locally stored files are served by the app itself
+	if local, ok := store.(*storage.LocalStorage); ok && strings.HasPrefix(cfg.Storage.PublicURL, "/") {
+		app.Static(cfg.Storage.PublicURL, local.Dir())
+	}
+
+	routes.SetupRoutes(app, db, redisClient, cfg, mail, store)
 
 	return app
 }
@@ -55,6 +67,15 @@ func customErrorHandler(c *fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
 	message := "Internal Server Error"
 
+	// Invalid request fields are listed individually
+	var fields services.FieldErrors
+	if errors.As(err, &fields) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  "Validation failed",
+			"fields": fields,
+		})
+	}
+
 	// Check if it's a Fiber error
 	if e, ok := err.(*fiber.Error); ok {
 		code = e.Code
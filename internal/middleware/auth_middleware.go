@@ -1,6 +1,14 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
 	"github.com/rafaalrazzak/e-campus-be/internal/services"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
 	"net/http"
@@ -17,12 +25,17 @@ type Config struct {
 	Config config.Config
 }
 
-// AuthorizationMiddleware validates user authorization based on token
+// AuthorizationMiddleware validates user authorization based on a session
+// token, or service account authorization based on an API key
 func AuthorizationMiddleware(db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if apiKey := extractAPIKey(c); apiKey != "" {
+			return authorizeAPIKey(c, services.NewAPIKeyService(db), apiKey)
+		}
 
 		authService := services.NewAuthService(db, redisDB, config)
-		userService := services.NewUserService(db)
+		userService := services.NewUserService(db, redisDB)
+		roleService := services.NewRoleService(db, redisDB)
 
 		// Get token from Authorization header
 		token := extractToken(c)
@@ -31,44 +44,126 @@ func AuthorizationMiddleware(db *database.ECampusDB, redisDB *redis.ECampusRedis
 			return fiber.NewError(http.StatusUnauthorized, "Missing or invalid authorization token")
 		}
 
-		userId, err := authService.GetSession(token)
+		session, err := authService.GetSession(token)
 
 		if err != nil {
 			return fiber.NewError(http.StatusUnauthorized, "Invalid or expired token")
 		}
 
-		// Retrieve user data
-		userData, err := userService.GetUserByID(*userId)
+		// Retrieve user data; deleted users lose access with their sessions intact
+		userData, err := userService.GetUserByID(session.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fiber.NewError(http.StatusUnauthorized, "Invalid or expired token")
+		}
 		if err != nil {
 			return fiber.NewError(http.StatusInternalServerError, err.Error())
 		}
+		if err := services.CheckAccountStatus(userData.Status); err != nil {
+			return err
+		}
+
+		permissions, err := roleService.PermissionsForRole(userData.Role)
+		if err != nil {
+			return err
+		}
+
+		// Store the caller in context
+		principal := &Principal{
+			User:        userData,
+			Session:     session,
+			Permissions: permissions,
+		}
+		c.Locals(principalKey, principal)
+
+		if session.ImpersonatorID != nil {
+			return impersonatedRequest(c, services.NewSecurityEventService(db), principal)
+		}
 
-		// Store user data and claims in context
-		c.Locals("userData", userData)
 		return c.Next()
 	}
 }
 
-// RoleAuthMiddleware checks if the user has the required role
-func RoleAuthMiddleware(requiredRoles ...string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userData, ok := c.Locals("userData").(map[string]interface{})
-		if !ok {
-			return fiber.NewError(http.StatusUnauthorized, "User data not found")
+// authorizeAPIKey authenticates a service account and records the request,
+// including its final status, in the API key audit log
+func authorizeAPIKey(c *fiber.Ctx, apiKeyService *services.APIKeyService, apiKey string) error {
+	principal, err := apiKeyService.Authenticate(apiKey)
+	if err != nil {
+		return err
+	}
+
+	c.Locals(principalKey, &Principal{
+		APIKey:      principal,
+		Permissions: principal.Scopes,
+	})
+	err = c.Next()
+
+	// Auditing must not change the outcome of the request
+	_ = apiKeyService.RecordRequest(models.APIKeyRequest{
+		APIKeyID: principal.KeyID,
+		Method:   c.Method(),
+		Path:     c.Path(),
+		Status:   responseStatus(c, err),
+		IP:       c.IP(),
+	})
+
+	return err
+}
+
+// impersonatedRequest flags the response as impersonated, refuses anything
+// but reads and writes every request to the security log
+func impersonatedRequest(c *fiber.Ctx, securityEvents *services.SecurityEventService, principal *Principal) error {
+	impersonatorID := principal.Session.ImpersonatorID
+	c.Set("X-Impersonated-By", strconv.FormatInt(*impersonatorID, 10))
+
+	var err error
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		err = c.Next()
+	default:
+		if allowed, _ := c.Locals(allowImpersonationKey).(bool); allowed {
+			err = c.Next()
+		} else {
+			err = fiber.NewError(http.StatusForbidden, "This action is not allowed while impersonating a user")
 		}
+	}
+
+	_ = securityEvents.Record(models.SecurityEvent{
+		EventType: models.SecurityEventImpersonatedRequest,
+		UserID:    &principal.User.ID,
+		ActorID:   impersonatorID,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Details:   fmt.Sprintf("%s %s %d", c.Method(), c.Path(), responseStatus(c, err)),
+	})
+
+	return err
+}
+
+// AllowImpersonation lets impersonation sessions use a write route, such as
+// logout. It must run before AuthorizationMiddleware.
+func AllowImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(allowImpersonationKey, true)
+		return c.Next()
+	}
+}
 
-		userRole, ok := userData["role"].(string)
+// RequirePermission allows the request only when the caller holds every listed
+// permission. It must run after AuthorizationMiddleware.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := GetPrincipal(c)
 		if !ok {
-			return fiber.NewError(http.StatusForbidden, "User role not found")
+			return fiber.NewError(http.StatusUnauthorized, "Missing or invalid authorization token")
 		}
 
-		for _, role := range requiredRoles {
-			if role == userRole {
-				return c.Next()
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				return fiber.NewError(http.StatusForbidden, "Insufficient permissions")
 			}
 		}
 
-		return fiber.NewError(http.StatusForbidden, "Insufficient permissions")
+		return c.Next()
 	}
 }
 
@@ -105,6 +200,33 @@ func RateLimitMiddleware(requests int, duration time.Duration) fiber.Handler {
 	}
 }
 
+// extractAPIKey returns the API key from the X-API-Key header, or from the
+// Authorization header when it carries an API key instead of a session token
+func extractAPIKey(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	if token := c.Get("Authorization"); strings.HasPrefix(token, constants.App.APIKeyPrefix) {
+		return token
+	}
+
+	return ""
+}
+
+// responseStatus is the status a request ends with, taking into account errors
+// that are only turned into a response by the error handler
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+
+	if e, ok := err.(*fiber.Error); ok {
+		return e.Code
+	}
+	return http.StatusInternalServerError
+}
+
 // extractToken helper function to extract token from Authorization header
 func extractToken(c *fiber.Ctx) string {
 	token := c.Get("Authorization")
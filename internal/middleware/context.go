@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+)
+
+// fiber.Locals keys used by the middleware in this package
+const (
+	principalKey          = "principal"
+	allowImpersonationKey = "allowImpersonation"
+)
+
+// Principal is the authenticated caller of a request: a user signed in with a
+// session, or a service account using an API key
+type Principal struct {
+	User        *services.UserDetails
+	Session     *services.Session
+	APIKey      *services.APIKeyPrincipal
+	Permissions []string // The user's role permissions, or the API key's scopes
+}
+
+// Can reports whether the principal holds a permission
+func (p *Principal) Can(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrincipal returns the caller set by AuthorizationMiddleware
+func GetPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(principalKey).(*Principal)
+	return principal, ok
+}
+
+// CurrentUser returns the signed-in user, failing for API key requests
+func CurrentUser(c *fiber.Ctx) (*services.UserDetails, error) {
+	principal, ok := GetPrincipal(c)
+	if !ok || principal.User == nil {
+		return nil, fiber.NewError(http.StatusUnauthorized, "User data not found")
+	}
+	return principal.User, nil
+}
+
+// CurrentSession returns the session the request was authenticated with
+func CurrentSession(c *fiber.Ctx) (*services.Session, error) {
+	principal, ok := GetPrincipal(c)
+	if !ok || principal.Session == nil {
+		return nil, fiber.NewError(http.StatusUnauthorized, "Session not found")
+	}
+	return principal.Session, nil
+}
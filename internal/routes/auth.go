@@ -2,19 +2,40 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
 	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
 )
 
 // SetupAuthRoutes configures all authentication-related routes
-func SetupAuthRoutes(app *fiber.App, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
-	authController := controllers.NewAuthController(db, redisDB, config)
+func SetupAuthRoutes(app *fiber.App, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config, mail mailer.Mailer) {
+	authController := controllers.NewAuthController(db, redisDB, config, mail)
+	twoFactorController := controllers.NewTwoFactorController(db, redisDB, config)
+	oidcController := controllers.NewOIDCController(db, redisDB, config)
 
 	auth := app.Group("/auth")
 
 	auth.Post("/login", authController.Login())
-	//auth.Post("/forgot-password", controllers.ForgotPassword(db))
-	//auth.Post("/reset-password", controllers.ResetPassword(db))
+	auth.Post("/refresh", authController.Refresh())
+	auth.Post("/logout", middleware.AllowImpersonation(), middleware.AuthorizationMiddleware(db, redisDB, config), authController.Logout())
+	auth.Post("/forgot-password", authController.ForgotPassword())
+	auth.Post("/reset-password", authController.ResetPassword())
+	auth.Get("/oidc/login", oidcController.Login())
+	auth.Get("/oidc/callback", oidcController.Callback())
+	auth.Post("/webauthn/login/begin", authController.BeginWebAuthnLogin())
+	auth.Post("/webauthn/login/finish", authController.FinishWebAuthnLogin())
+
+	auth.Get("/sessions/policies", middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.SessionsManage), authController.GetSessionPolicies())
+	auth.Put("/sessions/policies/:role", middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.SessionsManage), authController.SetSessionPolicy())
+
+	twoFactor := auth.Group("/2fa")
+	twoFactor.Post("/verify", twoFactorController.VerifyChallenge())
+	twoFactor.Post("/setup", twoFactorController.SetupChallenge())
+	twoFactor.Post("/enable", twoFactorController.EnableChallenge())
+	twoFactor.Get("/policies", middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.TwoFactorManage), twoFactorController.GetPolicies())
+	twoFactor.Put("/policies/:role", middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.TwoFactorManage), twoFactorController.SetPolicy())
 }
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupLecturerRoutes configures lecturer profiles and the candidate lists
+// used to assign advisors and classes
+func SetupLecturerRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
+	lecturerController := controllers.NewLecturerController(services.NewLecturerService(db))
+	canRead := middleware.RequirePermission(constants.Permissions.UsersRead)
+	canManage := middleware.RequirePermission(constants.Permissions.LecturersManage)
+
+	lecturers := router.Group("/lecturers")
+	lecturers.Use(middleware.AuthorizationMiddleware(db, redisDB, config))
+
+	lecturers.Get("/", canRead, lecturerController.GetLecturers())
+	lecturers.Patch("/me", lecturerController.UpdateMyProfile())
+	lecturers.Get("/advisor-candidates", canManage, lecturerController.GetAdvisorCandidates())
+	lecturers.Get("/course-candidates/:courseId", canManage, lecturerController.GetCourseCandidates())
+	lecturers.Get("/:id", canRead, lecturerController.GetLecturer())
+	lecturers.Patch("/:id", canManage, lecturerController.UpdateProfile())
+}
@@ -4,10 +4,18 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/storage"
 )
 
-func SetupRoutes(app *fiber.App, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
-	SetupAuthRoutes(app, db, redisDB, config)
-	SetupUserRoutes(app, db, redisDB, config)
+func SetupRoutes(app *fiber.App, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config, mail mailer.Mailer, store storage.Storage) {
+	SetupAuthRoutes(app, db, redisDB, config, mail)
+	SetupUserRoutes(app, db, redisDB, config, mail, store)
+	SetupServiceAccountRoutes(app, db, redisDB, config)
+	SetupRoleRoutes(app, db, redisDB, config)
+	SetupNumberingRoutes(app, db, redisDB, config)
+	SetupLecturerRoutes(app, db, redisDB, config)
+	SetupMetricsRoutes(app, db, redisDB, config)
+	SetupRegistrationRoutes(app, db, redisDB, config, mail)
 }
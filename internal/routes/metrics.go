@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupMetricsRoutes configures the operational metrics of this instance
+func SetupMetricsRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
+	metricsController := controllers.NewMetricsController()
+
+	metrics := router.Group("/metrics")
+	metrics.Use(middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.MetricsRead))
+
+	metrics.Get("/cache", metricsController.GetCacheStats())
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupNumberingRoutes configures the admin API for NIM/NIP numbering rules
+func SetupNumberingRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
+	numberingController := controllers.NewNumberingController(services.NewNumberingService(db))
+
+	rules := router.Group("/numbering-rules")
+	rules.Use(middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.NumberingManage))
+
+	rules.Get("/", numberingController.GetRules())
+	rules.Post("/", numberingController.CreateRule())
+	rules.Put("/:id", numberingController.UpdateRule())
+	rules.Delete("/:id", numberingController.DeleteRule())
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupRegistrationRoutes configures student self-registration and its admin review
+func SetupRegistrationRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config, mail mailer.Mailer) {
+	registrationController := controllers.NewRegistrationController(services.NewRegistrationService(db, redisDB, config, mail))
+	auth := middleware.AuthorizationMiddleware(db, redisDB, config)
+	canManage := middleware.RequirePermission(constants.Permissions.RegistrationsManage)
+
+	router.Post("/auth/register", registrationController.Register())
+	router.Post("/auth/register/resend", registrationController.ResendVerification())
+	router.Post("/auth/verify-email", registrationController.VerifyEmail())
+
+	registrations := router.Group("/registrations")
+	registrations.Use(auth, canManage)
+	registrations.Get("/", registrationController.GetRegistrations())
+	registrations.Post("/:id/approve", registrationController.Approve())
+	registrations.Post("/:id/reject", registrationController.Reject())
+
+	admissions := router.Group("/admissions")
+	admissions.Use(auth, canManage)
+	admissions.Get("/", registrationController.GetAdmissions())
+	admissions.Post("/", registrationController.ImportAdmissions())
+}
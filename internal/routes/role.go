@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupRoleRoutes configures the admin API for roles and their permissions
+func SetupRoleRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
+	roleController := controllers.NewRoleController(services.NewRoleService(db, redisDB))
+	auth := middleware.AuthorizationMiddleware(db, redisDB, config)
+	canManage := middleware.RequirePermission(constants.Permissions.RolesManage)
+
+	router.Get("/permissions", auth, canManage, roleController.GetPermissions())
+
+	roles := router.Group("/roles")
+	roles.Use(auth, canManage)
+
+	roles.Get("/", roleController.GetRoles())
+	roles.Post("/", roleController.CreateRole())
+	roles.Get("/:name", roleController.GetRole())
+	roles.Put("/:name", roleController.UpdateRole())
+	roles.Delete("/:name", roleController.DeleteRole())
+}
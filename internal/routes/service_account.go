@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
+	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
+	"github.com/rafaalrazzak/e-campus-be/internal/services"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// SetupServiceAccountRoutes configures the admin API for integration credentials
+func SetupServiceAccountRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
+	serviceAccountController := controllers.NewServiceAccountController(services.NewAPIKeyService(db))
+
+	accounts := router.Group("/service-accounts")
+	accounts.Use(middleware.AuthorizationMiddleware(db, redisDB, config), middleware.RequirePermission(constants.Permissions.ServiceAccountsManage))
+
+	accounts.Get("/", serviceAccountController.GetServiceAccounts())
+	accounts.Post("/", serviceAccountController.CreateServiceAccount())
+	accounts.Get("/:id", serviceAccountController.GetServiceAccount())
+	accounts.Delete("/:id", serviceAccountController.DisableServiceAccount())
+	accounts.Post("/:id/keys", serviceAccountController.CreateAPIKey())
+	accounts.Delete("/:id/keys/:keyId", serviceAccountController.RevokeAPIKey())
+	accounts.Get("/:id/requests", serviceAccountController.GetRequests())
+}
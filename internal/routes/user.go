@@ -3,29 +3,56 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
 	"github.com/rafaalrazzak/e-campus-be/internal/controllers"
 	"github.com/rafaalrazzak/e-campus-be/internal/middleware"
 	"github.com/rafaalrazzak/e-campus-be/internal/services"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/storage"
 )
 
-func SetupUserRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config) {
-	userService := services.NewUserService(db)
-	userController := controllers.NewUserController(userService)
+func SetupUserRoutes(router fiber.Router, db *database.ECampusDB, redisDB *redis.ECampusRedisDB, config config.Config, mail mailer.Mailer, store storage.Storage) {
+	userService := services.NewUserService(db, redisDB)
+	userController := controllers.NewUserController(userService, services.NewPasswordService(config), services.NewUserImportService(db, config), services.NewPhotoService(db, redisDB, store))
+	authController := controllers.NewAuthController(db, redisDB, config, mail)
+	twoFactorController := controllers.NewTwoFactorController(db, redisDB, config)
 
 	users := router.Group("/users")
 
-	// Public routes
-	users.Get("/", userController.GetUsers())
-
 	me := users.Group("/me")
 	me.Use(middleware.AuthorizationMiddleware(db, redisDB, config))
 	me.Get("/", userController.GetCurrentUser())
+	me.Patch("/", userController.UpdateCurrentUser())
+	me.Put("/photo", userController.UploadMyPhoto())
+	me.Get("/sessions", authController.GetSessions())
+	me.Delete("/sessions/:id", authController.RevokeSession())
+	me.Post("/2fa/setup", twoFactorController.Setup())
+	me.Post("/2fa/enable", twoFactorController.Enable())
+	me.Post("/2fa/disable", twoFactorController.Disable())
+	me.Post("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes())
+	me.Get("/webauthn", authController.GetWebAuthnCredentials())
+	me.Post("/webauthn/register/begin", authController.BeginWebAuthnRegistration())
+	me.Post("/webauthn/register/finish", authController.FinishWebAuthnRegistration())
+	me.Delete("/webauthn/:id", authController.DeleteWebAuthnCredential())
 
 	// Protected routes
-	users.Post("/", middleware.RoleAuthMiddleware("admin"), userController.CreateUser())
-	users.Put("/:id", middleware.RoleAuthMiddleware("admin"), userController.UpdateUser())
-	users.Delete("/:id", middleware.RoleAuthMiddleware("admin"), userController.DeleteUser())
+	auth := middleware.AuthorizationMiddleware(db, redisDB, config)
+	users.Get("/", auth, middleware.RequirePermission(constants.Permissions.UsersRead), userController.GetUsers())
+	users.Post("/", auth, middleware.RequirePermission(constants.Permissions.UsersCreate), userController.CreateUser())
+	users.Get("/export", auth, middleware.RequirePermission(constants.Permissions.UsersExport), userController.ExportUsers())
+	users.Post("/import", auth, middleware.RequirePermission(constants.Permissions.UsersCreate), userController.ImportUsers())
+	users.Put("/:id", auth, middleware.RequirePermission(constants.Permissions.UsersUpdate), userController.UpdateUser())
+	users.Put("/:id/photo", auth, middleware.RequirePermission(constants.Permissions.UsersUpdate), userController.UploadUserPhoto())
+	users.Post("/:id/status", auth, middleware.RequirePermission(constants.Permissions.UsersUpdate), userController.ChangeUserStatus())
+	users.Get("/:id/status-history", auth, middleware.RequirePermission(constants.Permissions.UsersRead), userController.GetStatusHistory())
+	users.Get("/:id/activity", auth, middleware.RequirePermission(constants.Permissions.UsersRead), userController.GetAcademicYearActivity())
+	users.Delete("/:id", auth, middleware.RequirePermission(constants.Permissions.UsersDelete), userController.DeleteUser())
+	users.Post("/:id/restore", auth, middleware.RequirePermission(constants.Permissions.UsersDelete), userController.RestoreUser())
+	users.Post("/:id/purge", auth, middleware.RequirePermission(constants.Permissions.UsersPurge), userController.PurgeUser())
+	users.Delete("/:id/sessions", auth, middleware.RequirePermission(constants.Permissions.SessionsRevoke), authController.RevokeAllSessions())
+	users.Post("/:id/unlock", auth, middleware.RequirePermission(constants.Permissions.UsersUnlock), authController.UnlockAccount())
+	users.Post("/:id/impersonate", auth, middleware.RequirePermission(constants.Permissions.UsersImpersonate), authController.Impersonate())
 }
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/listquery"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+)
+
+type APIKeyService struct {
+	db *database.ECampusDB
+}
+
+type ServiceAccountInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type APIKeyInput struct {
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// ServiceAccountDetails is a service account together with its keys
+type ServiceAccountDetails struct {
+	models.ServiceAccount
+	Keys []models.APIKey `json:"keys"`
+}
+
+// CreatedAPIKey carries the plain key, which is only ever returned once
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyPrincipal identifies the caller of a request authenticated with an API key
+type APIKeyPrincipal struct {
+	KeyID              int64         `json:"key_id"`
+	ServiceAccountID   int64         `json:"service_account_id"`
+	ServiceAccountName string        `json:"service_account_name"`
+	Scopes             models.Scopes `json:"scopes"`
+}
+
+func NewAPIKeyService(db *database.ECampusDB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+func (s *APIKeyService) CreateServiceAccount(input ServiceAccountInput, actorID int64) (*models.ServiceAccount, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+
+	account := models.ServiceAccount{
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		CreatedBy:   &actorID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("service_accounts").Rows(account).Returning("id").ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&account.ID, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "Service account name already in use")
+	}
+
+	return &account, nil
+}
+
+func (s *APIKeyService) GetServiceAccounts() ([]models.ServiceAccount, error) {
+	sqlQuery, _, err := s.db.QB.From("service_accounts").Order(goqu.I("name").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []models.ServiceAccount{}
+	if err := s.db.Conn.Select(&accounts, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (s *APIKeyService) GetServiceAccount(accountID int64) (*ServiceAccountDetails, error) {
+	var details ServiceAccountDetails
+
+	sqlQuery, _, err := s.db.QB.From("service_accounts").Where(goqu.Ex{"id": accountID}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&details.ServiceAccount, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	sqlQuery, _, err = s.db.QB.From("api_keys").
+		Where(goqu.Ex{"service_account_id": accountID}).
+		Order(goqu.I("created_at").Desc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	details.Keys = []models.APIKey{}
+	if err := s.db.Conn.Select(&details.Keys, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// DisableServiceAccount blocks the account and revokes all of its keys
+func (s *APIKeyService) DisableServiceAccount(accountID int64) error {
+	now := time.Now()
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery, _, err := s.db.QB.Update("service_accounts").
+		Set(goqu.Record{"disabled_at": now, "updated_at": now}).
+		Where(goqu.Ex{"id": accountID, "disabled_at": nil}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(sqlQuery)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	sqlQuery, _, err = s.db.QB.Update("api_keys").
+		Set(goqu.Record{"revoked_at": now}).
+		Where(goqu.Ex{"service_account_id": accountID, "revoked_at": nil}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateAPIKey issues a new key of the form eck_<prefix>_<secret>
+func (s *APIKeyService) CreateAPIKey(accountID int64, input APIKeyInput) (*CreatedAPIKey, error) {
+	if len(input.Scopes) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "At least one scope is required")
+	}
+
+	// Scopes are permission names, checked by RequirePermission like a role's
+	if err := NewRoleService(s.db, nil).ValidatePermissions(input.Scopes); err != nil {
+		return nil, err
+	}
+
+	expiresIn := constants.App.APIKeyDefaultExpiration
+	if input.ExpiresInDays > 0 {
+		expiresIn = time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	}
+	if expiresIn > constants.App.APIKeyMaxExpiration {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Expiration exceeds the maximum key lifetime")
+	}
+
+	account, err := s.GetServiceAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.DisabledAt != nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "Service account is disabled")
+	}
+
+	prefix, err := utils.GenerateRandomHex(4)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	rawKey := constants.App.APIKeyPrefix + prefix + "_" + secret
+	key := models.APIKey{
+		ServiceAccountID: accountID,
+		Prefix:           prefix,
+		KeyHash:          utils.HashToken(rawKey),
+		Scopes:           input.Scopes,
+		ExpiresAt:        time.Now().Add(expiresIn),
+		CreatedAt:        time.Now(),
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("api_keys").Rows(key).Returning("id").ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&key.ID, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPIKey{APIKey: key, Key: rawKey}, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(accountID, keyID int64) error {
+	sqlQuery, _, err := s.db.QB.Update("api_keys").
+		Set(goqu.Record{"revoked_at": time.Now()}).
+		Where(goqu.Ex{"id": keyID, "service_account_id": accountID, "revoked_at": nil}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Conn.Exec(sqlQuery)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Authenticate resolves a raw API key to its principal. Revoked, expired and
+// disabled keys are rejected with the same error.
+func (s *APIKeyService) Authenticate(rawKey string) (*APIKeyPrincipal, error) {
+	invalid := fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired API key")
+
+	rest, ok := strings.CutPrefix(rawKey, constants.App.APIKeyPrefix)
+	if !ok {
+		return nil, invalid
+	}
+
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" {
+		return nil, invalid
+	}
+
+	var row struct {
+		models.APIKey
+		ServiceAccountName string     `db:"service_account_name"`
+		AccountDisabledAt  *time.Time `db:"account_disabled_at"`
+	}
+
+	sqlQuery, _, err := s.db.QB.From("api_keys").
+		Select(
+			goqu.I("api_keys.*"),
+			goqu.I("service_accounts.name").As("service_account_name"),
+			goqu.I("service_accounts.disabled_at").As("account_disabled_at"),
+		).
+		InnerJoin(
+			goqu.T("service_accounts"),
+			goqu.On(goqu.Ex{"api_keys.service_account_id": goqu.I("service_accounts.id")}),
+		).
+		Where(goqu.Ex{"api_keys.prefix": prefix}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&row, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(row.KeyHash), []byte(utils.HashToken(rawKey))) != 1 {
+		return nil, invalid
+	}
+
+	if row.RevokedAt != nil || row.AccountDisabledAt != nil || time.Now().After(row.ExpiresAt) {
+		return nil, invalid
+	}
+
+	return &APIKeyPrincipal{
+		KeyID:              row.ID,
+		ServiceAccountID:   row.ServiceAccountID,
+		ServiceAccountName: row.ServiceAccountName,
+		Scopes:             row.Scopes,
+	}, nil
+}
+
+// RecordRequest writes the audit entry for a request made with an API key
+func (s *APIKeyService) RecordRequest(entry models.APIKeyRequest) error {
+	entry.CreatedAt = time.Now()
+
+	sqlQuery, _, err := s.db.QB.Insert("api_key_requests").Rows(entry).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return err
+	}
+
+	sqlQuery, _, err = s.db.QB.Update("api_keys").
+		Set(goqu.Record{"last_used_at": entry.CreatedAt}).
+		Where(goqu.Ex{"id": entry.APIKeyID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Conn.Exec(sqlQuery)
+	return err
+}
+
+// APIKeyRequestListSpec whitelists the fields the request audit log can be listed by
+var APIKeyRequestListSpec = listquery.Spec[models.APIKeyRequest]{
+	Fields: map[string]listquery.Field[models.APIKeyRequest]{
+		"id":         {Column: "api_key_requests.id", Type: listquery.Int, Filter: true, Sort: true, Value: func(r models.APIKeyRequest) any { return r.ID }},
+		"api_key_id": {Column: "api_key_requests.api_key_id", Type: listquery.Int, Filter: true},
+		"method":     {Column: "api_key_requests.method", Type: listquery.String, Filter: true},
+		"path":       {Column: "api_key_requests.path", Type: listquery.String, Filter: true},
+		"status":     {Column: "api_key_requests.status", Type: listquery.Int, Filter: true},
+		"ip":         {Column: "api_key_requests.ip", Type: listquery.String, Filter: true},
+		"created_at": {Column: "api_key_requests.created_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(r models.APIKeyRequest) any { return r.CreatedAt }},
+	},
+	DefaultSort:  "-created_at",
+	Key:          "id",
+	DefaultLimit: 100,
+	MaxLimit:     500,
+}
+
+type APIKeyRequestResponse struct {
+	Requests   []models.APIKeyRequest `json:"requests"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// GetRequests lists the audit entries across a service account's keys, most
+// recent first unless query sorts otherwise
+func (s *APIKeyService) GetRequests(accountID int64, query listquery.Query) (*APIKeyRequestResponse, error) {
+	if query.Limit < 1 {
+		query.Limit = APIKeyRequestListSpec.DefaultLimit
+	}
+
+	dataset := s.db.QB.From("api_key_requests").
+		Select(goqu.I("api_key_requests.*")).
+		InnerJoin(goqu.T("api_keys"), goqu.On(goqu.Ex{"api_key_requests.api_key_id": goqu.I("api_keys.id")})).
+		Where(goqu.Ex{"api_keys.service_account_id": accountID})
+	if filters := query.Where(); len(filters) > 0 {
+		dataset = dataset.Where(filters...)
+	}
+
+	sqlQuery, _, err := query.Page(dataset).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []models.APIKeyRequest{}
+	if err := s.db.Conn.Select(&requests, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	requests, next := APIKeyRequestListSpec.Next(query, requests)
+	return &APIKeyRequestResponse{Requests: requests, NextCursor: next}, nil
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/gofiber/fiber/v2"
@@ -12,69 +14,242 @@ import (
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	errSessionNotFound    = errors.New("session not found")
+	errRefreshTokenReused = errors.New("refresh token reused")
 )
 
 type AuthService struct {
-	db          *database.ECampusDB
-	redisClient *redis.ECampusRedisDB
-	config      config.Config
+	db             *database.ECampusDB
+	redisClient    *redis.ECampusRedisDB
+	config         config.Config
+	passwords      *PasswordService
+	securityEvents *SecurityEventService
 }
 
-type RegisterUserInput struct {
-	Name     string `json:"name"`
+// LoginInput holds the credentials of a password login
+type LoginInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	NimNip   string `json:"nim_nip"`
-	Role     string `json:"role"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthTokens is the token pair returned on login and refresh
+type AuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// LoginResult is either a full token pair or, for accounts protected by
+// two-factor authentication, a challenge that has to be completed first
+type LoginResult struct {
+	*AuthTokens
+	TwoFactorRequired      bool   `json:"two_factor_required,omitempty"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"`
+	ChallengeToken         string `json:"challenge_token,omitempty"`
 }
 
 func NewAuthService(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config) *AuthService {
 	return &AuthService{
-		db:          db,
-		redisClient: redisClient,
-		config:      cfg,
+		db:             db,
+		redisClient:    redisClient,
+		config:         cfg,
+		passwords:      NewPasswordService(cfg),
+		securityEvents: NewSecurityEventService(db),
 	}
 }
 
-func (s *AuthService) AuthenticateUser(credentials models.User) (string, error) {
+func (s *AuthService) AuthenticateUser(credentials LoginInput, client ClientInfo) (*LoginResult, error) {
 	if err := s.validateLoginInput(credentials); err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if err := s.checkLoginAllowed(credentials.Email, client.IP); err != nil {
+		return nil, err
 	}
 
 	dbUser, err := s.getUserFromDB(credentials.Email)
 	if err != nil {
-		return "", fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+		s.passwords.VerifyDummy(credentials.Password)
+		s.recordLoginFailure(credentials.Email, nil, client)
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
 	}
 
-	if err := s.verifyPassword(dbUser.Password, credentials.Password); err != nil {
-		return "", err
+	if err := s.verifyPassword(dbUser, credentials.Password); err != nil {
+		s.recordLoginFailure(credentials.Email, &dbUser.ID, client)
+		return nil, err
 	}
 
-	token, err := s.createSession(dbUser)
+	return s.completeLogin(dbUser, client)
+}
+
+// completeLogin runs the steps shared by every login method once the user is
+// identified: a two-factor challenge when needed, otherwise a new session.
+// Failed login counters are only reset once a session exists, so a correct
+// password alone does not reset the lockout for guessing second factors.
+func (s *AuthService) completeLogin(dbUser models.User, client ClientInfo) (*LoginResult, error) {
+	if err := s.checkLoginStatus(dbUser); err != nil {
+		return nil, err
+	}
+
+	enabled, required, err := s.twoFactorState(dbUser)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return token, nil
+	if enabled || required {
+		challenge, err := s.createTwoFactorChallenge(dbUser.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoginResult{
+			TwoFactorRequired:      true,
+			TwoFactorSetupRequired: !enabled,
+			ChallengeToken:         challenge,
+		}, nil
+	}
+
+	tokens, err := s.createSession(dbUser, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.resetLoginFailures(dbUser.Email)
+	return &LoginResult{AuthTokens: tokens}, nil
 }
 
-func (s *AuthService) GetSession(token string) (*int64, error) {
+func (s *AuthService) GetSession(token string) (*Session, error) {
 	userId, sessionId, err := s.ParseToken(token)
 	if err != nil {
 		return nil, err
 	}
 
-	redisKey := fmt.Sprintf(constants.Redis.SessionKey, userId, sessionId)
-	_, err = s.redisClient.Client.Get(context.Background(), redisKey).Result()
+	session, err := s.loadSession(userId, sessionId)
 	if err != nil {
 		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid session")
 	}
 
-	return &userId, nil
+	if err := s.checkSessionExpiry(session); err != nil {
+		return nil, err
+	}
+
+	if err := s.touchSession(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
 }
 
-func (s *AuthService) validateLoginInput(user models.User) error {
-	if user.Email == "" || user.Password == "" {
+// RefreshSession exchanges a refresh token for a new token pair. Every refresh
+// token is single use: presenting one that has already been rotated revokes
+// the whole session.
+func (s *AuthService) RefreshSession(refreshToken string) (*AuthTokens, error) {
+	if refreshToken == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Refresh token is required")
+	}
+
+	userId, sessionId, refreshId, err := s.parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.loadSession(userId, sessionId)
+	if errors.Is(err, errSessionNotFound) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid refresh token")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh session")
+	}
+
+	if err := s.checkSessionExpiry(session); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	refreshKey := fmt.Sprintf(constants.Redis.RefreshTokenKey, userId, sessionId)
+	sessionKey := fmt.Sprintf(constants.Redis.SessionKey, userId, sessionId)
+	newRefreshId := utils.GenerateId()
+	ttl := session.ttl(time.Now())
+
+	err = s.redisClient.Client.Watch(ctx, func(tx *goredis.Tx) error {
+		currentId, err := tx.Get(ctx, refreshKey).Int64()
+		if err != nil {
+			return errSessionNotFound
+		}
+
+		if currentId != refreshId {
+			return errRefreshTokenReused
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, refreshKey, newRefreshId, ttl)
+			pipe.Expire(ctx, sessionKey, ttl)
+			return nil
+		})
+		return err
+	}, refreshKey)
+
+	if errors.Is(err, errRefreshTokenReused) {
+		if err := s.revokeSession(userId, sessionId); err != nil {
+			return nil, err
+		}
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Refresh token reuse detected, session revoked")
+	}
+
+	if errors.Is(err, errSessionNotFound) || errors.Is(err, goredis.TxFailedErr) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to refresh session")
+	}
+
+	return s.issueTokens(userId, sessionId, newRefreshId)
+}
+
+// checkSessionExpiry revokes sessions that reached their absolute timeout. Idle
+// sessions need no check, Redis expires them.
+func (s *AuthService) checkSessionExpiry(session *Session) error {
+	if time.Now().Before(session.ExpiresAt) {
+		return nil
+	}
+
+	if err := s.revokeSession(session.UserID, session.ID); err != nil {
+		return err
+	}
+
+	return fiber.NewError(fiber.StatusUnauthorized, "Session expired")
+}
+
+// checkLoginStatus refuses accounts whose status does not allow logging in
+func (s *AuthService) checkLoginStatus(dbUser models.User) error {
+	return CheckAccountStatus(dbUser.Status)
+}
+
+// CheckAccountStatus refuses statuses that may not use the API. It is checked
+// at login and on every request, so a suspension takes effect immediately.
+func CheckAccountStatus(status string) error {
+	switch status {
+	case models.UserStatusPendingVerification:
+		return fiber.NewError(fiber.StatusForbidden, "Verify your email address before logging in")
+	case models.UserStatusSuspended:
+		return fiber.NewError(fiber.StatusForbidden, "Account is suspended")
+	case models.UserStatusRejected, models.UserStatusDroppedOut, models.UserStatusTransferred:
+		return fiber.NewError(fiber.StatusForbidden, "Account is not active")
+	}
+	return nil
+}
+
+func (s *AuthService) validateLoginInput(credentials LoginInput) error {
+	if credentials.Email == "" || credentials.Password == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Email and Password are required")
 	}
 	return nil
@@ -82,17 +257,42 @@ func (s *AuthService) validateLoginInput(user models.User) error {
 
 func (s *AuthService) getUserFromDB(email string) (models.User, error) {
 	var dbUser models.User
-	query := s.db.QB.From("users").Where(goqu.Ex{"email": email})
+	query := s.db.QB.From("users").Where(goqu.Ex{"email": email}, notDeleted)
+	sql, _, _ := query.ToSQL()
+	err := s.db.Conn.Get(&dbUser, sql)
+	return dbUser, err
+}
+
+func (s *AuthService) getUserByIDFromDB(userID int64) (models.User, error) {
+	var dbUser models.User
+	query := s.db.QB.From("users").Where(goqu.Ex{"id": userID}, notDeleted)
 	sql, _, _ := query.ToSQL()
 	err := s.db.Conn.Get(&dbUser, sql)
 	return dbUser, err
 }
 
-func (s *AuthService) verifyPassword(hashedPassword, inputPassword string) error {
-	isValid, err := utils.VerifyData(hashedPassword, inputPassword)
+// verifyPassword checks the password and upgrades hashes made with outdated
+// argon2 parameters. Values that are not argon2 hashes never match.
+func (s *AuthService) verifyPassword(dbUser models.User, inputPassword string) error {
+	isValid, rehashed, err := s.passwords.Verify(dbUser.Password, inputPassword)
+	if errors.Is(err, utils.ErrUnsupportedHash) {
+		// Accounts without a usable password take as long as any other
+		s.passwords.VerifyDummy(inputPassword)
+	}
 	if err != nil || !isValid {
 		return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
 	}
+
+	if rehashed != "" {
+		query := s.db.QB.Update("users").
+			Set(goqu.Record{"password": rehashed}).
+			Where(goqu.Ex{"id": dbUser.ID, "password": dbUser.Password})
+
+		if sqlQuery, args, err := query.ToSQL(); err == nil {
+			_, _ = s.db.Conn.Exec(sqlQuery, args...)
+		}
+	}
+
 	return nil
 }
 
@@ -102,40 +302,59 @@ func (s *AuthService) ParseToken(token string) (int64, int64, error) {
 		return 0, 0, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
 	}
 
-	userId, sessionId, err := utils.ParseSessionToken(decrypt)
+	userId, sessionId, expiresAt, err := utils.ParseSessionToken(decrypt)
 	if err != nil {
 		return 0, 0, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
 	}
+
+	if time.Now().Unix() >= expiresAt {
+		return 0, 0, fiber.NewError(fiber.StatusUnauthorized, "Token expired")
+	}
 	return userId, sessionId, nil
 }
 
-func (s *AuthService) createSession(dbUser models.User) (string, error) {
-	sessionId := utils.GenerateSessionToken()
-	sessionToken := fmt.Sprintf("%d::%d", dbUser.ID, sessionId)
-	token, err := utils.GenerateSessionEncryption(sessionToken, s.config)
+func (s *AuthService) parseRefreshToken(token string) (int64, int64, int64, error) {
+	decrypt, err := utils.DecryptSessionToken(token, s.config)
+	if err != nil {
+		return 0, 0, 0, fiber.NewError(fiber.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	userId, sessionId, refreshId, err := utils.ParseRefreshToken(decrypt)
 	if err != nil {
-		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+		return 0, 0, 0, fiber.NewError(fiber.StatusUnauthorized, "Invalid refresh token")
 	}
+	return userId, sessionId, refreshId, nil
+}
+
+func (s *AuthService) createSession(dbUser models.User, client ClientInfo) (*AuthTokens, error) {
+	sessionId := utils.GenerateSessionToken()
+	refreshId := utils.GenerateId()
 
-	if err := s.storeSession(dbUser.ID, sessionId); err != nil {
-		return "", err
+	if err := s.storeSession(dbUser, sessionId, refreshId, client); err != nil {
+		return nil, err
 	}
 
-	return token, nil
+	return s.issueTokens(dbUser.ID, sessionId, refreshId)
 }
 
-func (s *AuthService) storeSession(userID, sessionID int64) error {
-	ctx := context.Background()
-	redisKey := fmt.Sprintf(constants.Redis.SessionKey, userID, sessionID)
+// issueTokens encrypts a short-lived access token and the refresh token
+// currently registered for the session.
+func (s *AuthService) issueTokens(userID, sessionID, refreshID int64) (*AuthTokens, error) {
+	expiresAt := time.Now().Add(constants.App.AccessTokenExpiration)
 
-	// Store a blank session placeholder in Redis and set expiration
-	if err := s.redisClient.Client.Set(ctx, redisKey, "", constants.App.SessionExpiration).Err(); err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store session ID")
+	accessToken, err := utils.GenerateSessionEncryption(fmt.Sprintf("%d::%d::%d", userID, sessionID, expiresAt.Unix()), s.config)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
 	}
 
-	if err := s.redisClient.Client.Expire(ctx, redisKey, constants.App.SessionExpiration).Err(); err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set session expiration")
+	refreshToken, err := utils.GenerateSessionEncryption(fmt.Sprintf("refresh::%d::%d::%d", userID, sessionID, refreshID), s.config)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
 	}
 
-	return nil
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(constants.App.AccessTokenExpiration.Seconds()),
+	}, nil
 }
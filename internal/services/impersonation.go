@@ -0,0 +1,94 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+)
+
+// ImpersonationResult is the access token of an impersonation session. There
+// is no refresh token: the session ends when the access token expires.
+type ImpersonationResult struct {
+	AccessToken    string `json:"access_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+	UserID         int64  `json:"user_id"`
+	ImpersonatorID int64  `json:"impersonator_id"`
+}
+
+// Impersonate starts a short session as another user on behalf of an admin.
+// The session records the admin so requests made with it can be restricted
+// and audited.
+func (s *AuthService) Impersonate(adminID, userID int64, client ClientInfo) (*ImpersonationResult, error) {
+	if adminID == userID {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Cannot impersonate yourself")
+	}
+
+	user, err := s.getUserByIDFromDB(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start impersonation")
+	}
+
+	// Impersonating another admin would hand out their permissions
+	permissions, err := NewRoleService(s.db, s.redisClient).PermissionsForRole(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	if models.Scopes(permissions).Has(constants.Permissions.UsersImpersonate) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Users who can impersonate cannot be impersonated")
+	}
+
+	now := time.Now()
+	sessionID := utils.GenerateSessionToken()
+	session := Session{
+		ID:             sessionID,
+		UserID:         user.ID,
+		IP:             client.IP,
+		UserAgent:      client.UserAgent,
+		CreatedAt:      now,
+		LastSeen:       now,
+		ImpersonatorID: &adminID,
+
+		// Use does not extend an impersonation session
+		ExpiresAt:          now.Add(constants.App.ImpersonationExpiration),
+		IdleTimeoutSeconds: int64(constants.App.ImpersonationExpiration.Seconds()),
+	}
+
+	// The session is indexed like a login so revoking the user's sessions
+	// also ends the impersonation. It has no refresh token and does not count
+	// against the user's session limit.
+	expiration := constants.App.ImpersonationExpiration
+	if _, err := s.putSession(user.ID, session, "", -1, expiration, expiration); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start impersonation")
+	}
+
+	expiresAt := now.Add(constants.App.ImpersonationExpiration)
+	accessToken, err := utils.GenerateSessionEncryption(fmt.Sprintf("%d::%d::%d", user.ID, sessionID, expiresAt.Unix()), s.config)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate token")
+	}
+
+	s.logSecurityEvent(models.SecurityEvent{
+		EventType: models.SecurityEventImpersonationStarted,
+		UserID:    &user.ID,
+		ActorID:   &adminID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   fmt.Sprintf("session %d", sessionID),
+	})
+
+	return &ImpersonationResult{
+		AccessToken:    accessToken,
+		ExpiresIn:      int64(constants.App.ImpersonationExpiration.Seconds()),
+		UserID:         user.ID,
+		ImpersonatorID: adminID,
+	}, nil
+}
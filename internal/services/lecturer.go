@@ -0,0 +1,565 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/listquery"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+)
+
+const (
+	maxLecturerExpertise   = 20
+	maxLecturerEducation   = 10
+	maxLecturerAdvisees    = 100
+	maxLecturerCredits     = 40
+	maxExpertiseAreaLength = 100
+)
+
+var academicRanks = map[string]bool{
+	models.AcademicRankAssistant:      true,
+	models.AcademicRankLecturer:       true,
+	models.AcademicRankSeniorLecturer: true,
+	models.AcademicRankProfessor:      true,
+}
+
+var educationDegrees = map[string]bool{
+	"bachelor":     true,
+	"master":       true,
+	"doctorate":    true,
+	"professional": true,
+}
+
+// LecturerService manages lecturer profiles. Every user with the lecturer
+// role has one, created with the user; study plan advisors and class
+// lecturers must have one too.
+type LecturerService struct {
+	db *database.ECampusDB
+}
+
+func NewLecturerService(db *database.ECampusDB) *LecturerService {
+	return &LecturerService{db: db}
+}
+
+// Lecturer is a lecturer profile with the public fields of its user
+type Lecturer struct {
+	ID             int64   `db:"id" json:"id"`
+	NimNip         string  `db:"nim_nip" json:"nip"`
+	Name           string  `db:"name" json:"name"`
+	Email          string  `db:"email" json:"email"`
+	DepartmentCode *string `db:"department_code" json:"department_code"`
+	models.LecturerProfile
+}
+
+// LecturerListSpec whitelists the fields lecturers can be listed by
+var LecturerListSpec = listquery.Spec[Lecturer]{
+	Fields: map[string]listquery.Field[Lecturer]{
+		"id":                 {Column: "users.id", Type: listquery.Int, Filter: true, Sort: true, Value: func(l Lecturer) any { return l.ID }},
+		"name":               {Column: "users.name", Type: listquery.String, Filter: true, Sort: true, Value: func(l Lecturer) any { return l.Name }},
+		"nip":                {Column: "users.nim_nip", Type: listquery.String, Filter: true, Sort: true, Value: func(l Lecturer) any { return l.NimNip }},
+		"nidn":               {Column: "lecturer_profiles.nidn", Type: listquery.String, Filter: true},
+		"academic_rank":      {Column: "lecturer_profiles.academic_rank", Type: listquery.String, Filter: true},
+		"department_code":    {Column: "users.department_code", Type: listquery.String, Filter: true},
+		"accepting_advisees": {Column: "lecturer_profiles.accepting_advisees", Type: listquery.Bool, Filter: true},
+	},
+	DefaultSort:  "name",
+	Key:          "id",
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+type LecturerFilters struct {
+	Query     listquery.Query // Parsed with LecturerListSpec
+	Expertise string          // Substring of any research area, case insensitive
+}
+
+type LecturerResponse struct {
+	Lecturers  []Lecturer `json:"lecturers"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// LecturerEducationInput is a degree of LecturerProfileInput
+type LecturerEducationInput struct {
+	Degree         string `json:"degree"`
+	Field          string `json:"field"`
+	Institution    string `json:"institution"`
+	GraduationYear *int   `json:"graduation_year"`
+}
+
+// LecturerProfileInput updates a profile; nil fields are left unchanged.
+// Expertise and Education replace the current lists, an empty list clears
+// them. An empty NIDN or academic rank clears it.
+type LecturerProfileInput struct {
+	Nidn               *string                   `json:"nidn"`
+	AcademicRank       *string                   `json:"academic_rank"`
+	Expertise          *[]string                 `json:"expertise"`
+	Education          *[]LecturerEducationInput `json:"education"`
+	AcceptingAdvisees  *bool                     `json:"accepting_advisees"`
+	MaxAdvisees        *int                      `json:"max_advisees"`
+	MaxTeachingCredits *int                      `json:"max_teaching_credits"`
+}
+
+// OwnLecturerProfileInput holds the fields lecturers may edit on their own
+// profile; NIDN, rank and capacity are set by administrators
+type OwnLecturerProfileInput struct {
+	Expertise         *[]string                 `json:"expertise"`
+	Education         *[]LecturerEducationInput `json:"education"`
+	AcceptingAdvisees *bool                     `json:"accepting_advisees"`
+}
+
+// lecturers selects the profiles of lecturers that were not deleted
+func (s *LecturerService) lecturers() *goqu.SelectDataset {
+	return s.db.QB.From("lecturer_profiles").
+		Join(goqu.T("users"), goqu.On(goqu.I("users.id").Eq(goqu.I("lecturer_profiles.user_id")))).
+		Select(
+			goqu.I("users.id"),
+			goqu.I("users.nim_nip"),
+			goqu.I("users.name"),
+			goqu.I("users.email"),
+			goqu.I("users.department_code"),
+			goqu.I("lecturer_profiles.*"),
+		).
+		Where(goqu.Ex{"users.role": models.RoleLecturer}, notDeleted)
+}
+
+// GetLecturers lists lecturers with their expertise
+func (s *LecturerService) GetLecturers(params LecturerFilters) (*LecturerResponse, error) {
+	if params.Query.Limit < 1 {
+		params.Query.Limit = LecturerListSpec.DefaultLimit
+	}
+
+	query := s.lecturers()
+	if filters := params.Query.Where(); len(filters) > 0 {
+		query = query.Where(filters...)
+	}
+	if params.Expertise != "" {
+		query = query.Where(goqu.L(
+			"EXISTS (SELECT 1 FROM lecturer_expertise WHERE lecturer_expertise.user_id = users.id AND lecturer_expertise.area ILIKE ?)",
+			"%"+likeEscaper.Replace(params.Expertise)+"%",
+		))
+	}
+
+	sqlQuery, _, err := params.Query.Page(query).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	lecturers := []Lecturer{}
+	if err := s.db.Conn.Select(&lecturers, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch lecturers")
+	}
+
+	lecturers, next := LecturerListSpec.Next(params.Query, lecturers)
+	if err := s.loadExpertise(lecturers); err != nil {
+		return nil, err
+	}
+
+	return &LecturerResponse{Lecturers: lecturers, NextCursor: next}, nil
+}
+
+// loadExpertise fills in the research areas of lecturers
+func (s *LecturerService) loadExpertise(lecturers []Lecturer) error {
+	if len(lecturers) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Lecturer, len(lecturers))
+	ids := make([]int64, len(lecturers))
+	for i := range lecturers {
+		lecturers[i].Expertise = []string{}
+		byID[lecturers[i].ID] = &lecturers[i]
+		ids[i] = lecturers[i].ID
+	}
+
+	sqlQuery, _, err := s.db.QB.From("lecturer_expertise").
+		Where(goqu.C("user_id").In(ids)).
+		Order(goqu.I("area").Asc()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	var rows []struct {
+		UserID int64  `db:"user_id"`
+		Area   string `db:"area"`
+	}
+	if err := s.db.Conn.Select(&rows, sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch lecturers")
+	}
+
+	for _, row := range rows {
+		lecturer := byID[row.UserID]
+		lecturer.Expertise = append(lecturer.Expertise, row.Area)
+	}
+
+	return nil
+}
+
+// GetLecturer returns a lecturer with their expertise and education
+func (s *LecturerService) GetLecturer(userID int64) (*Lecturer, error) {
+	sqlQuery, _, err := s.lecturers().Where(goqu.Ex{"users.id": userID}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var lecturer Lecturer
+	if err := s.db.Conn.Get(&lecturer, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Lecturer not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch lecturer")
+	}
+
+	lecturers := []Lecturer{lecturer}
+	if err := s.loadExpertise(lecturers); err != nil {
+		return nil, err
+	}
+	lecturer = lecturers[0]
+
+	sqlQuery, _, err = s.db.QB.From("lecturer_education").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("graduation_year").Asc().NullsLast(), goqu.I("id").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	lecturer.Education = []models.LecturerEducation{}
+	if err := s.db.Conn.Select(&lecturer.Education, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch lecturer")
+	}
+
+	return &lecturer, nil
+}
+
+// UpdateProfile changes the profile of a lecturer
+func (s *LecturerService) UpdateProfile(userID int64, input LecturerProfileInput) (*Lecturer, error) {
+	record, expertise, education, err := lecturerProfileRecord(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Profiles are created with the user, but not for users made lecturers
+	// before profiles existed
+	if err := s.EnsureProfiles(tx, userID); err != nil {
+		return nil, err
+	}
+
+	// Profiles of deleted users, or of users who are no longer lecturers, are kept but not edited
+	lecturers := s.db.QB.From("users").Select("id").Where(goqu.Ex{"role": models.RoleLecturer}, notDeleted)
+
+	record["updated_at"] = time.Now()
+	sqlQuery, _, err := s.db.QB.Update("lecturer_profiles").
+		Set(record).
+		Where(goqu.Ex{"user_id": userID}, goqu.C("user_id").In(lecturers)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(sqlQuery)
+	if err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, FieldErrors{"nidn": "is already in use"}
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update lecturer profile")
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Lecturer not found")
+	}
+
+	if expertise != nil {
+		if err := s.replaceRows(tx, "lecturer_expertise", userID, expertise); err != nil {
+			return nil, err
+		}
+	}
+	if education != nil {
+		if err := s.replaceRows(tx, "lecturer_education", userID, education); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetLecturer(userID)
+}
+
+// UpdateOwnProfile changes the fields lecturers may edit themselves
+func (s *LecturerService) UpdateOwnProfile(userID int64, input OwnLecturerProfileInput) (*Lecturer, error) {
+	return s.UpdateProfile(userID, LecturerProfileInput{
+		Expertise:         input.Expertise,
+		Education:         input.Education,
+		AcceptingAdvisees: input.AcceptingAdvisees,
+	})
+}
+
+// replaceRows replaces the rows of a lecturer in one of the profile list tables
+func (s *LecturerService) replaceRows(tx *sqlx.Tx, table string, userID int64, rows []interface{}) error {
+	sqlQuery, _, err := s.db.QB.Delete(table).Where(goqu.Ex{"user_id": userID}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update lecturer profile")
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	sqlQuery, _, err = s.db.QB.Insert(table).Rows(rows...).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update lecturer profile")
+	}
+
+	return nil
+}
+
+// lecturerProfileRecord validates a profile update. The expertise and
+// education rows are nil when the lists are left unchanged.
+func lecturerProfileRecord(userID int64, input LecturerProfileInput) (goqu.Record, []interface{}, []interface{}, error) {
+	fields := FieldErrors{}
+	record := goqu.Record{}
+
+	if input.Nidn != nil {
+		nidn := strings.TrimSpace(*input.Nidn)
+		switch {
+		case nidn == "":
+			record["nidn"] = nil
+		case len(nidn) != 10 || strings.Trim(nidn, "0123456789") != "":
+			fields.Add("nidn", "must be 10 digits")
+		default:
+			record["nidn"] = nidn
+		}
+	}
+
+	if input.AcademicRank != nil {
+		switch rank := *input.AcademicRank; {
+		case rank == "":
+			record["academic_rank"] = nil
+		case !academicRanks[rank]:
+			fields.Add("academic_rank", "must be asisten_ahli, lektor, lektor_kepala or guru_besar")
+		default:
+			record["academic_rank"] = rank
+		}
+	}
+
+	if input.AcceptingAdvisees != nil {
+		record["accepting_advisees"] = *input.AcceptingAdvisees
+	}
+	if input.MaxAdvisees != nil {
+		if *input.MaxAdvisees < 0 || *input.MaxAdvisees > maxLecturerAdvisees {
+			fields.Add("max_advisees", fmt.Sprintf("must be between 0 and %d", maxLecturerAdvisees))
+		}
+		record["max_advisees"] = *input.MaxAdvisees
+	}
+	if input.MaxTeachingCredits != nil {
+		if *input.MaxTeachingCredits < 0 || *input.MaxTeachingCredits > maxLecturerCredits {
+			fields.Add("max_teaching_credits", fmt.Sprintf("must be between 0 and %d", maxLecturerCredits))
+		}
+		record["max_teaching_credits"] = *input.MaxTeachingCredits
+	}
+
+	var expertise []interface{}
+	if input.Expertise != nil {
+		expertise = []interface{}{}
+		if len(*input.Expertise) > maxLecturerExpertise {
+			fields.Add("expertise", fmt.Sprintf("must have at most %d areas", maxLecturerExpertise))
+		}
+
+		seen := make(map[string]bool)
+		for i, area := range *input.Expertise {
+			area = strings.TrimSpace(area)
+			key := strings.ToLower(area)
+			switch {
+			case area == "":
+				fields.Add(fmt.Sprintf("expertise[%d]", i), "must not be empty")
+			case utf8.RuneCountInString(area) > maxExpertiseAreaLength:
+				fields.Add(fmt.Sprintf("expertise[%d]", i), fmt.Sprintf("must be at most %d characters long", maxExpertiseAreaLength))
+			case !seen[key]:
+				seen[key] = true
+				expertise = append(expertise, goqu.Record{"user_id": userID, "area": area})
+			}
+		}
+	}
+
+	var education []interface{}
+	if input.Education != nil {
+		education = []interface{}{}
+		if len(*input.Education) > maxLecturerEducation {
+			fields.Add("education", fmt.Sprintf("must have at most %d degrees", maxLecturerEducation))
+		}
+
+		for i, degree := range *input.Education {
+			field := func(name string) string { return fmt.Sprintf("education[%d].%s", i, name) }
+
+			row := models.LecturerEducation{
+				UserID:         userID,
+				Degree:         degree.Degree,
+				Field:          strings.TrimSpace(degree.Field),
+				Institution:    strings.TrimSpace(degree.Institution),
+				GraduationYear: degree.GraduationYear,
+			}
+			if !educationDegrees[row.Degree] {
+				fields.Add(field("degree"), "must be bachelor, master, doctorate or professional")
+			}
+			if row.Field == "" || len(row.Field) > 255 {
+				fields.Add(field("field"), "is required and must be at most 255 characters long")
+			}
+			if row.Institution == "" || len(row.Institution) > 255 {
+				fields.Add(field("institution"), "is required and must be at most 255 characters long")
+			}
+			if year := row.GraduationYear; year != nil && (*year < 1950 || *year > time.Now().Year()) {
+				fields.Add(field("graduation_year"), fmt.Sprintf("must be between 1950 and %d", time.Now().Year()))
+			}
+			education = append(education, row)
+		}
+	}
+
+	if err := fields.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return record, expertise, education, nil
+}
+
+// EnsureProfiles creates an empty profile for each of the users that is a
+// lecturer and has none. It must run with every write that can make a user a
+// lecturer, in the same transaction.
+func (s *LecturerService) EnsureProfiles(tx sqlx.Execer, userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("lecturer_profiles").
+		Cols("user_id").
+		FromQuery(s.db.QB.From("users").
+			Select("id").
+			Where(goqu.C("id").In(userIDs), goqu.Ex{"role": models.RoleLecturer})).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(sqlQuery)
+	return err
+}
+
+// LecturerCandidate is a lecturer who can take on more work, with their
+// current load in the active academic year
+type LecturerCandidate struct {
+	Lecturer
+	Load     int `db:"load" json:"load"`         // Advisees, or teaching credits
+	Capacity int `db:"capacity" json:"capacity"` // MaxAdvisees, or MaxTeachingCredits
+}
+
+// activeAcademicYears selects the ids of the active academic years
+func (s *LecturerService) activeAcademicYears() *goqu.SelectDataset {
+	return s.db.QB.From("academic_years").Select("id").Where(goqu.Ex{"is_active": true})
+}
+
+// candidates selects active lecturers with their load below their capacity,
+// in the given order and then least loaded first
+func (s *LecturerService) candidates(load *goqu.SelectDataset, capacity string, conditions []exp.Expression, order ...exp.OrderedExpression) ([]LecturerCandidate, error) {
+	query := s.db.QB.From(s.lecturers().
+		SelectAppend(
+			goqu.L("COALESCE((?), 0)", load).As("load"),
+			goqu.I("lecturer_profiles."+capacity).As("capacity"),
+		).
+		Where(goqu.Ex{"users.status": models.UserStatusActive}).
+		As("lecturers"))
+
+	sqlQuery, _, err := query.
+		Where(goqu.C("load").Lt(goqu.C("capacity"))).
+		Where(conditions...).
+		Order(append(order, goqu.C("load").Asc(), goqu.C("name").Asc(), goqu.C("id").Asc())...).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []LecturerCandidate{}
+	if err := s.db.Conn.Select(&candidates, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch candidates")
+	}
+
+	return candidates, nil
+}
+
+// AdvisorCandidates lists the lecturers who accept more advisees in the
+// active academic year, optionally only those of a department
+func (s *LecturerService) AdvisorCandidates(departmentCode string) ([]LecturerCandidate, error) {
+	advisees := s.db.QB.From("study_plans").
+		Select(goqu.COUNT(goqu.DISTINCT("student_id"))).
+		Where(
+			goqu.I("study_plans.advisor_id").Eq(goqu.I("users.id")),
+			goqu.I("study_plans.academic_year_id").In(s.activeAcademicYears()),
+		)
+
+	conditions := []exp.Expression{goqu.C("accepting_advisees").IsTrue()}
+	if departmentCode != "" {
+		conditions = append(conditions, goqu.C("department_code").Eq(departmentCode))
+	}
+
+	return s.candidates(advisees, "max_advisees", conditions)
+}
+
+// CourseCandidates lists the lecturers who can teach another class of a
+// course in the active academic year without exceeding their teaching
+// credits, lecturers of the course's department first
+func (s *LecturerService) CourseCandidates(courseID int64) ([]LecturerCandidate, error) {
+	sqlQuery, _, err := s.db.QB.From("courses").
+		Select("credits", "department_code").
+		Where(goqu.Ex{"id": courseID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var course struct {
+		Credits        int     `db:"credits"`
+		DepartmentCode *string `db:"department_code"`
+	}
+	if err := s.db.Conn.Get(&course, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Course not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch course")
+	}
+
+	credits := s.db.QB.From("class_schedules").
+		Join(goqu.T("courses"), goqu.On(goqu.I("courses.id").Eq(goqu.I("class_schedules.course_id")))).
+		Select(goqu.SUM("courses.credits")).
+		Where(
+			goqu.I("class_schedules.lecturer_id").Eq(goqu.I("users.id")),
+			goqu.I("class_schedules.academic_year_id").In(s.activeAcademicYears()),
+		)
+
+	return s.candidates(credits, "max_teaching_credits",
+		[]exp.Expression{goqu.L("load + ? <= capacity", course.Credits)},
+		goqu.L("department_code IS NOT DISTINCT FROM ?", course.DepartmentCode).Desc(),
+	)
+}
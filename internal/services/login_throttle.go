@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	loginScopeEmail = "email"
+	loginScopeIP    = "ip"
+)
+
+var errTooManyAttempts = fiber.NewError(fiber.StatusTooManyRequests, "Too many login attempts, please try again later")
+
+// checkLoginAllowed rejects the attempt while the email or IP is locked out or
+// still inside its backoff window. The answer is the same for unknown emails.
+func (s *AuthService) checkLoginAllowed(email, ip string) error {
+	ctx := context.Background()
+
+	for _, scope := range [][2]string{{loginScopeEmail, normalizeEmail(email)}, {loginScopeIP, ip}} {
+		lockKey := fmt.Sprintf(constants.Redis.LoginLockKey, scope[0], scope[1])
+		locked, err := s.redisClient.Client.Exists(ctx, lockKey).Result()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check login attempts")
+		}
+		if locked > 0 {
+			return errTooManyAttempts
+		}
+
+		attemptsKey := fmt.Sprintf(constants.Redis.LoginAttemptsKey, scope[0], scope[1])
+		attempts, err := s.redisClient.Client.HGetAll(ctx, attemptsKey).Result()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check login attempts")
+		}
+
+		count, _ := strconv.ParseInt(attempts["count"], 10, 64)
+		lastFailed, _ := strconv.ParseInt(attempts["last_failed_at"], 10, 64)
+		if time.Now().Before(time.UnixMilli(lastFailed).Add(loginBackoff(count))) {
+			return errTooManyAttempts
+		}
+	}
+
+	return nil
+}
+
+// recordLoginFailure bumps the failure counters, locks the email or IP once a
+// threshold is reached and writes the attempt to the security log
+func (s *AuthService) recordLoginFailure(email string, userID *int64, client ClientInfo) {
+	ctx := context.Background()
+	email = normalizeEmail(email)
+
+	s.logSecurityEvent(models.SecurityEvent{
+		EventType: models.SecurityEventLoginFailed,
+		UserID:    userID,
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+
+	scopes := []struct {
+		name      string
+		value     string
+		threshold int64
+	}{
+		{loginScopeEmail, email, constants.App.LoginEmailLockoutThreshold},
+		{loginScopeIP, client.IP, constants.App.LoginIPLockoutThreshold},
+	}
+
+	for _, scope := range scopes {
+		attemptsKey := fmt.Sprintf(constants.Redis.LoginAttemptsKey, scope.name, scope.value)
+
+		var count *goredis.IntCmd
+		_, err := s.redisClient.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			count = pipe.HIncrBy(ctx, attemptsKey, "count", 1)
+			pipe.HSet(ctx, attemptsKey, "last_failed_at", time.Now().UnixMilli())
+			pipe.Expire(ctx, attemptsKey, constants.App.LoginFailureWindow)
+			return nil
+		})
+		if err != nil || count.Val() < scope.threshold {
+			continue
+		}
+
+		lockKey := fmt.Sprintf(constants.Redis.LoginLockKey, scope.name, scope.value)
+		s.redisClient.Client.Set(ctx, lockKey, time.Now().Unix(), constants.App.LoginLockoutDuration)
+		s.redisClient.Client.Del(ctx, attemptsKey)
+
+		s.logSecurityEvent(models.SecurityEvent{
+			EventType: models.SecurityEventAccountLocked,
+			UserID:    userID,
+			Email:     email,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   fmt.Sprintf("%s locked after %d failed attempts", scope.name, count.Val()),
+		})
+	}
+}
+
+// resetLoginFailures clears the email counters after a successful login. IP
+// counters are left alone so one valid account cannot reset a spraying IP.
+func (s *AuthService) resetLoginFailures(email string) {
+	attemptsKey := fmt.Sprintf(constants.Redis.LoginAttemptsKey, loginScopeEmail, normalizeEmail(email))
+	s.redisClient.Client.Del(context.Background(), attemptsKey)
+}
+
+// UnlockAccount lifts a lockout and clears failed attempts for a user
+func (s *AuthService) UnlockAccount(userID, actorID int64) error {
+	user, err := s.getUserByIDFromDB(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+
+	email := normalizeEmail(user.Email)
+	err = s.redisClient.Client.Del(context.Background(),
+		fmt.Sprintf(constants.Redis.LoginLockKey, loginScopeEmail, email),
+		fmt.Sprintf(constants.Redis.LoginAttemptsKey, loginScopeEmail, email),
+	).Err()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to unlock account")
+	}
+
+	s.logSecurityEvent(models.SecurityEvent{
+		EventType: models.SecurityEventAccountUnlocked,
+		UserID:    &user.ID,
+		ActorID:   &actorID,
+		Email:     email,
+	})
+
+	return nil
+}
+
+func (s *AuthService) logSecurityEvent(event models.SecurityEvent) {
+	// The security log must never turn a login failure into a server error
+	_ = s.securityEvents.Record(event)
+}
+
+// loginBackoff returns how long to wait after the given number of failures:
+// nothing for the first few, then doubling up to LoginBackoffMax
+func loginBackoff(failures int64) time.Duration {
+	if failures <= constants.App.LoginFreeAttempts {
+		return 0
+	}
+
+	delay := constants.App.LoginBackoffBase
+	for i := constants.App.LoginFreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= constants.App.LoginBackoffMax {
+			return constants.App.LoginBackoffMax
+		}
+	}
+
+	return delay
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,599 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+)
+
+// ErrNoNumberingRule is returned when no rule matches the role and department
+// of a user that needs a NIM/NIP
+var ErrNoNumberingRule = errors.New("no numbering rule matches the role and department")
+
+// numberingPlaceholder matches a template placeholder such as {yy} or {seq:4}
+var numberingPlaceholder = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+const (
+	defaultSequenceWidth = 4
+	maxSequenceWidth     = 12
+	// numberingMaxAttempts bounds how many numbers already taken by hand are
+	// skipped before giving up
+	numberingMaxAttempts = 100
+)
+
+// NumberingService generates NIM/NIP identifiers from per role and department
+// templates. Templates combine literal text with these placeholders:
+//
+//	{year}   entry year, e.g. 2024 (the current year when unknown)
+//	{yy}     last two digits of the entry year
+//	{dept}   department code
+//	{seq:N}  sequence number padded to N digits, 4 without :N
+//
+// Sequences are counted per scope, the identifier with the sequence left out,
+// so "{yy}{dept}{seq:4}" numbers every department and year from 1.
+type NumberingService struct {
+	db *database.ECampusDB
+}
+
+type NimNipRuleInput struct {
+	Role           string  `json:"role"`
+	DepartmentCode *string `json:"department_code"`
+	Template       string  `json:"template"`
+}
+
+func NewNumberingService(db *database.ECampusDB) *NumberingService {
+	return &NumberingService{db: db}
+}
+
+// numberingTemplate is a parsed template; the sequence sits between prefix
+// and suffix
+type numberingTemplate struct {
+	prefix []templatePart
+	suffix []templatePart
+	width  int
+}
+
+// templatePart is either literal text or a placeholder name
+type templatePart struct {
+	literal     string
+	placeholder string
+}
+
+func parseNumberingTemplate(template string) (numberingTemplate, error) {
+	var parsed numberingTemplate
+	if template == "" {
+		return parsed, errors.New("must not be empty")
+	}
+	if len(template) > 100 {
+		return parsed, errors.New("must be at most 100 characters long")
+	}
+
+	seen := false
+	parts := &parsed.prefix
+	add := func(literal string) error {
+		if strings.ContainsAny(literal, "{} \t\r\n") {
+			return fmt.Errorf("contains an invalid placeholder or whitespace near %q", literal)
+		}
+		if literal != "" {
+			*parts = append(*parts, templatePart{literal: literal})
+		}
+		return nil
+	}
+
+	last := 0
+	for _, match := range numberingPlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		if err := add(template[last:match[0]]); err != nil {
+			return parsed, err
+		}
+		last = match[1]
+
+		name := template[match[2]:match[3]]
+		hasWidth := match[4] >= 0
+		switch name {
+		case "year", "yy", "dept":
+			if hasWidth {
+				return parsed, fmt.Errorf("{%s} does not take a width", name)
+			}
+			*parts = append(*parts, templatePart{placeholder: name})
+		case "seq":
+			if seen {
+				return parsed, errors.New("must contain {seq} only once")
+			}
+			seen = true
+
+			parsed.width = defaultSequenceWidth
+			if hasWidth {
+				width, err := strconv.Atoi(template[match[4]:match[5]])
+				if err != nil || width < 1 || width > maxSequenceWidth {
+					return parsed, fmt.Errorf("{seq} width must be between 1 and %d", maxSequenceWidth)
+				}
+				parsed.width = width
+			}
+			parts = &parsed.suffix
+		default:
+			return parsed, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+	}
+	if err := add(template[last:]); err != nil {
+		return parsed, err
+	}
+
+	if !seen {
+		return parsed, errors.New("must contain {seq}")
+	}
+
+	return parsed, nil
+}
+
+// scope renders the template without its sequence, which is left as {seq}
+func (t numberingTemplate) scope(departmentCode string, year int) (string, error) {
+	render := func(parts []templatePart) (string, error) {
+		var b strings.Builder
+		for _, part := range parts {
+			switch part.placeholder {
+			case "":
+				b.WriteString(part.literal)
+			case "year":
+				fmt.Fprintf(&b, "%04d", year)
+			case "yy":
+				fmt.Fprintf(&b, "%02d", year%100)
+			case "dept":
+				if departmentCode == "" {
+					return "", FieldErrors{"department_code": "is required to generate a NIM/NIP"}
+				}
+				b.WriteString(departmentCode)
+			}
+		}
+		return b.String(), nil
+	}
+
+	prefix, err := render(t.prefix)
+	if err != nil {
+		return "", err
+	}
+	suffix, err := render(t.suffix)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + "{seq}" + suffix, nil
+}
+
+// pattern matches identifiers generated by the template for a department,
+// capturing the sequence
+func (t numberingTemplate) pattern(departmentCode string) *regexp.Regexp {
+	expression := func(parts []templatePart) string {
+		var b strings.Builder
+		for _, part := range parts {
+			switch part.placeholder {
+			case "":
+				b.WriteString(regexp.QuoteMeta(part.literal))
+			case "year":
+				b.WriteString(`\d{4}`)
+			case "yy":
+				b.WriteString(`\d{2}`)
+			case "dept":
+				b.WriteString(regexp.QuoteMeta(departmentCode))
+			}
+		}
+		return b.String()
+	}
+
+	return regexp.MustCompile("^" + expression(t.prefix) + `(\d+)` + expression(t.suffix) + "$")
+}
+
+func formatNimNip(scope string, width int, value int64) string {
+	return strings.Replace(scope, "{seq}", fmt.Sprintf("%0*d", width, value), 1)
+}
+
+func (s *NumberingService) GetRules() ([]models.NimNipRule, error) {
+	sqlQuery, _, err := s.db.QB.From("nim_nip_rules").
+		Order(goqu.I("role").Asc(), goqu.I("department_code").Asc().NullsFirst()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []models.NimNipRule{}
+	if err := s.db.Conn.Select(&rules, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch numbering rules")
+	}
+
+	return rules, nil
+}
+
+// CreateRule adds a rule and starts its sequences after the identifiers
+// already in use
+func (s *NumberingService) CreateRule(input NimNipRuleInput) (*models.NimNipRule, error) {
+	if err := validateNimNipRule(input); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rule := models.NimNipRule{
+		Role:           models.Role(input.Role),
+		DepartmentCode: input.DepartmentCode,
+		Template:       input.Template,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("nim_nip_rules").Rows(rule).Returning("id").ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&rule.ID, sqlQuery); err != nil {
+		return nil, ruleWriteError(err)
+	}
+
+	if err := s.SyncSequences(rule); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// UpdateRule replaces a rule. Numbers already handed out are kept.
+func (s *NumberingService) UpdateRule(ruleID int64, input NimNipRuleInput) (*models.NimNipRule, error) {
+	if err := validateNimNipRule(input); err != nil {
+		return nil, err
+	}
+
+	sqlQuery, _, err := s.db.QB.Update("nim_nip_rules").
+		Set(goqu.Record{
+			"role":            input.Role,
+			"department_code": input.DepartmentCode,
+			"template":        input.Template,
+			"updated_at":      time.Now(),
+		}).
+		Where(goqu.Ex{"id": ruleID}).
+		Returning("*").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var rule models.NimNipRule
+	if err := s.db.Conn.Get(&rule, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Numbering rule not found")
+		}
+		return nil, ruleWriteError(err)
+	}
+
+	if err := s.SyncSequences(rule); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (s *NumberingService) DeleteRule(ruleID int64) error {
+	sqlQuery, _, err := s.db.QB.Delete("nim_nip_rules").Where(goqu.Ex{"id": ruleID}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Conn.Exec(sqlQuery)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete numbering rule")
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Numbering rule not found")
+	}
+
+	return nil
+}
+
+func validateNimNipRule(input NimNipRuleInput) error {
+	fields := FieldErrors{}
+	if input.Role == "" {
+		fields.Add("role", "is required")
+	}
+	if input.DepartmentCode != nil && *input.DepartmentCode == "" {
+		fields.Add("department_code", "must be null or a department code")
+	}
+	if _, err := parseNumberingTemplate(input.Template); err != nil {
+		fields.Add("template", err.Error())
+	}
+	return fields.Err()
+}
+
+func ruleWriteError(err error) error {
+	switch pgErrorCode(err) {
+	case "23505":
+		return fiber.NewError(fiber.StatusConflict, "A numbering rule for this role and department already exists")
+	case "23503":
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid role or department")
+	default:
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save numbering rule")
+	}
+}
+
+// Generate allocates the next NIM/NIP for a new user. It must run in the
+// transaction that inserts the user: the sequence row stays locked until then,
+// so concurrent users never get the same number and a rollback returns it.
+func (s *NumberingService) Generate(tx *sqlx.Tx, role string, departmentCode *string, entryYear *int) (string, error) {
+	conditions := goqu.Or(goqu.Ex{"department_code": nil})
+	if departmentCode != nil {
+		conditions = goqu.Or(goqu.Ex{"department_code": *departmentCode}, goqu.Ex{"department_code": nil})
+	}
+
+	// A department's own rule wins over the role default
+	sqlQuery, _, err := s.db.QB.From("nim_nip_rules").
+		Select("template").
+		Where(goqu.Ex{"role": role}, conditions).
+		Order(goqu.L("department_code IS NULL").Asc()).
+		Limit(1).
+		ToSQL()
+	if err != nil {
+		return "", err
+	}
+
+	var template string
+	if err := tx.Get(&template, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoNumberingRule
+		}
+		return "", err
+	}
+
+	parsed, err := parseNumberingTemplate(template)
+	if err != nil {
+		return "", fmt.Errorf("numbering rule %q: %w", template, err)
+	}
+
+	year := time.Now().Year()
+	if entryYear != nil {
+		year = *entryYear
+	}
+	department := ""
+	if departmentCode != nil {
+		department = *departmentCode
+	}
+
+	scope, err := parsed.scope(department, year)
+	if err != nil {
+		return "", err
+	}
+
+	sqlQuery, _, err = s.db.QB.Insert("nim_nip_sequences").
+		Rows(goqu.Record{"scope": scope, "last_value": 1}).
+		OnConflict(goqu.DoUpdate("scope", goqu.Record{"last_value": goqu.L("nim_nip_sequences.last_value + 1")})).
+		Returning("last_value").
+		ToSQL()
+	if err != nil {
+		return "", err
+	}
+
+	// Numbers entered by hand can sit ahead of the sequence; skip them
+	for attempt := 0; attempt < numberingMaxAttempts; attempt++ {
+		var value int64
+		if err := tx.Get(&value, sqlQuery); err != nil {
+			return "", err
+		}
+
+		nimNip := formatNimNip(scope, parsed.width, value)
+		takenQuery, _, err := s.db.QB.Select(goqu.L("EXISTS ?", s.db.QB.From("users").Where(goqu.Ex{"nim_nip": nimNip}))).ToSQL()
+		if err != nil {
+			return "", err
+		}
+
+		var taken bool
+		if err := tx.Get(&taken, takenQuery); err != nil {
+			return "", err
+		}
+		if !taken {
+			return nimNip, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free NIM/NIP in %s after %d attempts", scope, numberingMaxAttempts)
+}
+
+// SyncSequences moves the sequences of a rule past the identifiers already
+// matching its template, so generated numbers follow manually entered ones
+func (s *NumberingService) SyncSequences(rule models.NimNipRule) error {
+	parsed, err := parseNumberingTemplate(rule.Template)
+	if err != nil {
+		return err
+	}
+	conditions := goqu.Ex{"role": rule.Role}
+	if rule.DepartmentCode != nil {
+		conditions["department_code"] = *rule.DepartmentCode
+	}
+
+	sqlQuery, _, err := s.db.QB.From("users").Select("nim_nip", goqu.COALESCE(goqu.C("department_code"), "")).Where(conditions).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Conn.Queryx(sqlQuery)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to sync numbering sequences")
+	}
+	defer rows.Close()
+
+	highest := make(map[string]int64)
+	patterns := make(map[string]*regexp.Regexp)
+	for rows.Next() {
+		var nimNip, departmentCode string
+		if err := rows.Scan(&nimNip, &departmentCode); err != nil {
+			return err
+		}
+
+		pattern, ok := patterns[departmentCode]
+		if !ok {
+			pattern = parsed.pattern(departmentCode)
+			patterns[departmentCode] = pattern
+		}
+
+		match := pattern.FindStringSubmatchIndex(nimNip)
+		if match == nil {
+			continue
+		}
+		value, err := strconv.ParseInt(nimNip[match[2]:match[3]], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		scope := nimNip[:match[2]] + "{seq}" + nimNip[match[3]:]
+		if value > highest[scope] {
+			highest[scope] = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(highest) == 0 {
+		return nil
+	}
+
+	records := make([]interface{}, 0, len(highest))
+	for scope, value := range highest {
+		records = append(records, goqu.Record{"scope": scope, "last_value": value})
+	}
+
+	sqlQuery, _, err = s.db.QB.Insert("nim_nip_sequences").
+		Rows(records...).
+		OnConflict(goqu.DoUpdate("scope", goqu.Record{
+			"last_value": goqu.L("GREATEST(nim_nip_sequences.last_value, EXCLUDED.last_value)"),
+		})).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to sync numbering sequences")
+	}
+
+	return nil
+}
+
+// NimNipIssue is a user whose NIM/NIP is missing or shared with another user
+type NimNipIssue struct {
+	UserID    int64  `json:"user_id"`
+	NimNip    string `json:"nim_nip"`
+	Problem   string `json:"problem"` // "missing" or "duplicate"
+	NewNimNip string `json:"new_nim_nip,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type NimNipReport struct {
+	Issues     []NimNipIssue `json:"issues"`
+	Renumbered int           `json:"renumbered"`
+}
+
+// CheckNimNips finds users with an empty or duplicated NIM/NIP. The oldest
+// holder keeps a duplicated number. With fix set the other users are given
+// new numbers by the numbering rules.
+func (s *NumberingService) CheckNimNips(fix bool) (*NimNipReport, error) {
+	duplicated := s.db.QB.From("users").
+		Select("nim_nip").
+		GroupBy("nim_nip").
+		Having(goqu.COUNT("*").Gt(1))
+
+	sqlQuery, _, err := s.db.QB.From("users").
+		Select("id", "nim_nip", "role", "department_code", "entry_year").
+		Where(goqu.Or(
+			goqu.L("TRIM(nim_nip) = ''"),
+			goqu.C("nim_nip").In(duplicated),
+		)).
+		Order(goqu.I("nim_nip").Asc(), goqu.I("created_at").Asc(), goqu.I("id").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []struct {
+		ID             int64   `db:"id"`
+		NimNip         string  `db:"nim_nip"`
+		Role           string  `db:"role"`
+		DepartmentCode *string `db:"department_code"`
+		EntryYear      *int    `db:"entry_year"`
+	}
+	if err := s.db.Conn.Select(&users, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	if fix {
+		rules, err := s.GetRules()
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if err := s.SyncSequences(rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report := &NimNipReport{Issues: []NimNipIssue{}}
+	kept := make(map[string]bool)
+	for _, user := range users {
+		issue := NimNipIssue{UserID: user.ID, NimNip: user.NimNip, Problem: "duplicate"}
+		if strings.TrimSpace(user.NimNip) == "" {
+			issue.Problem = "missing"
+		} else if !kept[user.NimNip] {
+			kept[user.NimNip] = true
+			continue
+		}
+
+		if fix {
+			nimNip, err := s.renumber(user.ID, user.Role, user.DepartmentCode, user.EntryYear)
+			if err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.NewNimNip = nimNip
+				report.Renumbered++
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return report, nil
+}
+
+// renumber gives an existing user a newly generated NIM/NIP. It runs from the
+// CLI without Redis, so cached user details catch up when they expire.
+func (s *NumberingService) renumber(userID int64, role string, departmentCode *string, entryYear *int) (string, error) {
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	nimNip, err := s.Generate(tx, role, departmentCode, entryYear)
+	if err != nil {
+		return "", err
+	}
+
+	sqlQuery, _, err := s.db.QB.Update("users").
+		Set(goqu.Record{"nim_nip": nimNip, "updated_at": time.Now()}).
+		Where(goqu.Ex{"id": userID}).
+		ToSQL()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return "", err
+	}
+
+	return nimNip, tx.Commit()
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+)
+
+// OIDCService implements the authorization code flow with PKCE against the
+// campus identity provider
+type OIDCService struct {
+	db          *database.ECampusDB
+	redisClient *redis.ECampusRedisDB
+	config      config.OIDC
+	authService *AuthService
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// oidcState is kept in Redis between the redirect to the IdP and the callback
+type oidcState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func NewOIDCService(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, authService *AuthService) *OIDCService {
+	return &OIDCService{
+		db:          db,
+		redisClient: redisClient,
+		config:      cfg.OIDC,
+		authService: authService,
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.config.IssuerURL != ""
+}
+
+// AuthorizationURL starts a login and returns the IdP URL to redirect to,
+// along with the state the caller binds to the browser
+func (s *OIDCService) AuthorizationURL(ctx context.Context) (string, string, error) {
+	oauthConfig, _, err := s.clients(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+
+	stored := oidcState{Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+
+	redisKey := fmt.Sprintf(constants.Redis.OIDCStateKey, state)
+	if err := s.redisClient.Client.Set(ctx, redisKey, data, constants.App.OIDCStateExpiration).Err(); err != nil {
+		return "", "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+
+	return authCodeURL(oauthConfig, state, stored), state, nil
+}
+
+func authCodeURL(oauthConfig *oauth2.Config, state string, stored oidcState) string {
+	return oauthConfig.AuthCodeURL(state,
+		oidc.Nonce(stored.Nonce),
+		oauth2.S256ChallengeOption(stored.Verifier),
+	)
+}
+
+// HandleCallback exchanges the authorization code, verifies the ID token and
+// logs in the matching e-campus user. boundState is the state stored in the
+// browser that started the login, so a callback carrying someone else's code
+// is rejected.
+func (s *OIDCService) HandleCallback(ctx context.Context, code, state, boundState string, client ClientInfo) (*LoginResult, error) {
+	if code == "" || state == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Code and state are required")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(boundState)) != 1 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired state")
+	}
+
+	// States are single use
+	data, err := s.redisClient.Client.GetDel(ctx, fmt.Sprintf(constants.Redis.OIDCStateKey, state)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired state")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to verify state")
+	}
+
+	var stored oidcState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired state")
+	}
+
+	claims, err := s.exchange(ctx, code, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	dbUser, err := s.matchUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.completeLogin(dbUser, client)
+}
+
+// exchange redeems the code with the PKCE verifier and returns the claims of
+// the ID token once its signature, audience and nonce check out
+func (s *OIDCService) exchange(ctx context.Context, code string, stored oidcState) (map[string]interface{}, error) {
+	oauthConfig, verifier, err := s.clients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(stored.Verifier))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Failed to exchange authorization code")
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Identity provider did not return an ID token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid ID token")
+	}
+
+	if idToken.Nonce != stored.Nonce {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid ID token")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid ID token")
+	}
+
+	return claims, nil
+}
+
+// matchUser links the identity to a users row by email, falling back to the
+// configured NIM/NIP claim
+func (s *OIDCService) matchUser(claims map[string]interface{}) (models.User, error) {
+	var dbUser models.User
+
+	email, nimNip := s.identity(claims)
+	if email != "" {
+		err := s.getUser(&dbUser, goqu.Func("LOWER", goqu.C("email")).Eq(email))
+		if err == nil {
+			return dbUser, nil
+		}
+	}
+
+	if nimNip != "" {
+		err := s.getUser(&dbUser, goqu.Ex{"nim_nip": nimNip})
+		if err == nil {
+			return dbUser, nil
+		}
+	}
+
+	return dbUser, fiber.NewError(fiber.StatusForbidden, "No e-campus account is linked to this identity")
+}
+
+// identity maps the claims to the email and NIM/NIP users are matched by.
+// The email is dropped when a verified one is required and the IdP did not
+// assert email_verified, since a missing claim proves nothing.
+func (s *OIDCService) identity(claims map[string]interface{}) (email, nimNip string) {
+	email, _ = claims[s.config.EmailClaim].(string)
+	verified, _ := claims["email_verified"].(bool)
+	if s.config.RequireVerifiedEmail && !verified {
+		email = ""
+	}
+	email = normalizeEmail(email)
+
+	if s.config.NimNipClaim != "" {
+		nimNip = claimString(claims[s.config.NimNipClaim])
+	}
+
+	return email, nimNip
+}
+
+func (s *OIDCService) getUser(dbUser *models.User, where goqu.Expression) error {
+	sqlQuery, _, err := s.db.QB.From("users").Where(where, notDeleted).Limit(1).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Conn.Get(dbUser, sqlQuery)
+}
+
+// clients discovers the provider on first use so the API can start while the
+// IdP is unreachable
+func (s *OIDCService) clients(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	if !s.Enabled() {
+		return nil, nil, fiber.NewError(fiber.StatusNotFound, "Single sign-on is not configured")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(ctx, s.config.IssuerURL)
+		if err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadGateway, "Identity provider is unavailable")
+		}
+		s.provider = provider
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		RedirectURL:  s.config.RedirectURL,
+		Endpoint:     s.provider.Endpoint(),
+		Scopes:       s.config.Scopes,
+	}
+
+	verifier := s.provider.Verifier(&oidc.Config{ClientID: s.config.ClientID})
+
+	return oauthConfig, verifier, nil
+}
+
+// claimString accepts string and numeric claims, since some IdPs emit NIM as a number
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+const testClientID = "e-campus"
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS, an authorization
+// endpoint that approves every request and a token endpoint that checks PKCE
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{} // Extra claims put in every ID token
+
+	mu       sync.Mutex
+	requests map[string]url.Values // Authorization requests by issued code
+	nonce    string                // Overrides the requested nonce when set
+}
+
+func newMockIdP(t *testing.T, claims map[string]interface{}) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{t: t, key: key, claims: claims, requests: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                idp.server.URL,
+		"authorization_endpoint":                idp.server.URL + "/authorize",
+		"token_endpoint":                        idp.server.URL + "/token",
+		"jwks_uri":                              idp.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	code := "code-" + r.URL.Query().Get("state")
+
+	idp.mu.Lock()
+	idp.requests[code] = r.URL.Query()
+	idp.mu.Unlock()
+
+	redirect := r.URL.Query().Get("redirect_uri") + "?" + url.Values{
+		"code":  {code},
+		"state": {r.URL.Query().Get("state")},
+	}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	request, ok := idp.requests[r.PostForm.Get("code")]
+	delete(idp.requests, r.PostForm.Get("code"))
+	nonce := idp.nonce
+	idp.mu.Unlock()
+
+	if !ok {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if request.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	if nonce == "" {
+		nonce = request.Get("nonce")
+	}
+
+	claims := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"sub":   "idp-user-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+func (idp *mockIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func newTestOIDCService(issuer string) *OIDCService {
+	return NewOIDCService(nil, nil, config.Config{OIDC: config.OIDC{
+		IssuerURL:            issuer,
+		ClientID:             testClientID,
+		ClientSecret:         "secret",
+		RedirectURL:          "https://api.example.ac.id/auth/oidc/callback",
+		Scopes:               []string{"openid", "email"},
+		EmailClaim:           "email",
+		NimNipClaim:          "nim",
+		RequireVerifiedEmail: true,
+	}}, nil)
+}
+
+// authorizeCode runs the browser leg: it follows the authorization URL to the
+// IdP and returns the code handed back to the redirect URI
+func authorizeCode(t *testing.T, s *OIDCService, stored oidcState) (string, url.Values) {
+	t.Helper()
+
+	oauthConfig, _, err := s.clients(context.Background())
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+
+	authURL, err := url.Parse(authCodeURL(oauthConfig, "state-1", stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query().Get("code"), authURL.Query()
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newMockIdP(t, map[string]interface{}{
+		"email":          "Student@Example.ac.id",
+		"email_verified": true,
+		"nim":            2022010001, // Some IdPs emit the NIM as a number
+	})
+	s := newTestOIDCService(idp.server.URL)
+
+	stored := oidcState{Nonce: "nonce-1", Verifier: "verifier-0123456789-0123456789-0123456789-0123"}
+	code, request := authorizeCode(t, s, stored)
+
+	if request.Get("code_challenge_method") != "S256" || request.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 challenge: %v", request)
+	}
+	if request.Get("nonce") != stored.Nonce {
+		t.Fatalf("authorization URL nonce = %q, want %q", request.Get("nonce"), stored.Nonce)
+	}
+
+	claims, err := s.exchange(context.Background(), code, stored)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	email, nimNip := s.identity(claims)
+	if email != "student@example.ac.id" {
+		t.Errorf("email = %q, want student@example.ac.id", email)
+	}
+	if nimNip != "2022010001" {
+		t.Errorf("nim = %q, want 2022010001", nimNip)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t, nil)
+	s := newTestOIDCService(idp.server.URL)
+
+	stored := oidcState{Nonce: "nonce-1", Verifier: "verifier-0123456789-0123456789-0123456789-0123"}
+	code, _ := authorizeCode(t, s, stored)
+
+	stored.Verifier = "another-verifier-0123456789-0123456789-0123456"
+	if _, err := s.exchange(context.Background(), code, stored); err == nil {
+		t.Fatal("exchange accepted a code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCExchangeRejectsWrongNonce(t *testing.T) {
+	idp := newMockIdP(t, nil)
+	idp.nonce = "replayed-nonce"
+	s := newTestOIDCService(idp.server.URL)
+
+	stored := oidcState{Nonce: "nonce-1", Verifier: "verifier-0123456789-0123456789-0123456789-0123"}
+	code, _ := authorizeCode(t, s, stored)
+
+	if _, err := s.exchange(context.Background(), code, stored); err == nil {
+		t.Fatal("exchange accepted an ID token with another nonce")
+	}
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	tests := []struct {
+		name         string
+		requireEmail bool
+		claims       map[string]interface{}
+		email        string
+		nimNip       string
+	}{
+		{
+			name:         "verified email",
+			requireEmail: true,
+			claims:       map[string]interface{}{"email": " A@Example.ac.id ", "email_verified": true},
+			email:        "a@example.ac.id",
+		},
+		{
+			name:         "unverified email",
+			requireEmail: true,
+			claims:       map[string]interface{}{"email": "a@example.ac.id", "email_verified": false, "nim": "2022010001"},
+			nimNip:       "2022010001",
+		},
+		{
+			name:         "missing email_verified",
+			requireEmail: true,
+			claims:       map[string]interface{}{"email": "a@example.ac.id"},
+		},
+		{
+			name:         "verification not required",
+			requireEmail: false,
+			claims:       map[string]interface{}{"email": "a@example.ac.id"},
+			email:        "a@example.ac.id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOIDCService("https://idp.example.ac.id")
+			s.config.RequireVerifiedEmail = tt.requireEmail
+
+			email, nimNip := s.identity(tt.claims)
+			if email != tt.email || nimNip != tt.nimNip {
+				t.Errorf("identity() = (%q, %q), want (%q, %q)", email, nimNip, tt.email, tt.nimNip)
+			}
+		})
+	}
+}
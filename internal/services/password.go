@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/matthewhartstonge/argon2"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// sha1HexPattern matches a line of a HIBP style list ("HASH" or "HASH:count")
+var sha1HexPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// breachedLists caches loaded breached-password files by path, since services
+// are constructed per request
+var breachedLists sync.Map
+
+type breachedList struct {
+	once   sync.Once
+	hashes map[string]struct{}
+	err    error
+}
+
+// PasswordService enforces the password policy and owns password hashing
+type PasswordService struct {
+	config config.Password
+}
+
+func NewPasswordService(cfg config.Config) *PasswordService {
+	return &PasswordService{config: cfg.Password}
+}
+
+// Validate checks a new password against the policy and the breached list.
+// Every failed rule is reported in a single error.
+func (s *PasswordService) Validate(password string) error {
+	var problems []string
+
+	length := utf8.RuneCountInString(password)
+	if length < s.config.MinLength {
+		problems = append(problems, "be at least "+strconv.Itoa(s.config.MinLength)+" characters long")
+	}
+	if length > s.config.MaxLength {
+		problems = append(problems, "be at most "+strconv.Itoa(s.config.MaxLength)+" characters long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if s.config.RequireUpper && !hasUpper {
+		problems = append(problems, "contain an uppercase letter")
+	}
+	if s.config.RequireLower && !hasLower {
+		problems = append(problems, "contain a lowercase letter")
+	}
+	if s.config.RequireDigit && !hasDigit {
+		problems = append(problems, "contain a digit")
+	}
+	if s.config.RequireSymbol && !hasSymbol {
+		problems = append(problems, "contain a symbol")
+	}
+
+	if len(problems) > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Password must "+strings.Join(problems, ", "))
+	}
+
+	breached, err := s.isBreached(password)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to check password")
+	}
+	if breached {
+		return fiber.NewError(fiber.StatusBadRequest, "Password appears in a list of breached passwords, choose another one")
+	}
+
+	return nil
+}
+
+// Hash validates a new password and hashes it with the configured parameters
+func (s *PasswordService) Hash(password string) (string, error) {
+	if err := s.Validate(password); err != nil {
+		return "", err
+	}
+
+	hashed, err := utils.HashData(password, s.params())
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to hash password")
+	}
+
+	return hashed, nil
+}
+
+// Verify checks a password against a stored hash. When the hash was made with
+// other parameters, rehashed holds a replacement made with the current ones.
+func (s *PasswordService) Verify(encodedHash, password string) (ok bool, rehashed string, err error) {
+	ok, outdated, err := utils.VerifyData(encodedHash, password, s.params())
+	if err != nil || !ok {
+		return false, "", err
+	}
+
+	if outdated {
+		// The login still succeeds if the upgrade fails; it is retried next time
+		rehashed, _ = utils.HashData(password, s.params())
+	}
+
+	return true, rehashed, nil
+}
+
+// dummyHashes caches a hash per parameter set for VerifyDummy
+var dummyHashes sync.Map
+
+// VerifyDummy takes as long as Verify with the current parameters. It runs
+// when there is no hash to check, so response times do not reveal whether an
+// account exists or can log in with a password.
+func (s *PasswordService) VerifyDummy(password string) {
+	params := s.params()
+
+	hash, ok := dummyHashes.Load(params)
+	if !ok {
+		generated, err := utils.HashData("not a real password", params)
+		if err != nil {
+			return
+		}
+		hash, _ = dummyHashes.LoadOrStore(params, generated)
+	}
+
+	_, _, _ = utils.VerifyData(hash.(string), password, params)
+}
+
+func (s *PasswordService) params() argon2.Config {
+	params := argon2.DefaultConfig()
+	params.TimeCost = s.config.Argon2Time
+	params.MemoryCost = s.config.Argon2MemoryKiB
+	params.Parallelism = s.config.Argon2Threads
+	return params
+}
+
+func (s *PasswordService) isBreached(password string) (bool, error) {
+	if s.config.BreachedListFile == "" {
+		return false, nil
+	}
+
+	value, _ := breachedLists.LoadOrStore(s.config.BreachedListFile, &breachedList{})
+	list := value.(*breachedList)
+	list.once.Do(func() {
+		list.hashes, list.err = loadBreachedList(s.config.BreachedListFile)
+	})
+	if list.err != nil {
+		return false, list.err
+	}
+
+	sum := sha1.Sum([]byte(password))
+	_, found := list.hashes[hex.EncodeToString(sum[:])]
+	return found, nil
+}
+
+// loadBreachedList reads a file of plain passwords or SHA-1 hashes into a set
+// of lowercase SHA-1 hex digests. Empty lines and lines starting with # are skipped.
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if sha1HexPattern.MatchString(line) {
+			hashes[strings.ToLower(line[:40])] = struct{}{}
+			continue
+		}
+
+		sum := sha1.Sum([]byte(line))
+		hashes[hex.EncodeToString(sum[:])] = struct{}{}
+	}
+
+	return hashes, scanner.Err()
+}
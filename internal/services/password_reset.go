@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type PasswordResetService struct {
+	db          *database.ECampusDB
+	redisClient *redis.ECampusRedisDB
+	config      config.Config
+	mailer      mailer.Mailer
+	authService *AuthService
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewPasswordResetService(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, mail mailer.Mailer, authService *AuthService) *PasswordResetService {
+	return &PasswordResetService{
+		db:          db,
+		redisClient: redisClient,
+		config:      cfg,
+		mailer:      mail,
+		authService: authService,
+	}
+}
+
+// RequestReset emails a single-use reset link. Unknown emails are ignored so
+// the caller cannot tell which accounts exist.
+func (s *PasswordResetService) RequestReset(input ForgotPasswordInput) error {
+	if input.Email == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Email is required")
+	}
+
+	user, err := s.authService.getUserFromDB(input.Email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate reset token")
+	}
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf(constants.Redis.PasswordResetKey, utils.HashToken(token))
+	if err := s.redisClient.Client.Set(ctx, redisKey, user.ID, constants.App.PasswordResetExpiration).Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store reset token")
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your e-campus password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s/reset-password?token=%s\n\nIf you did not request this, you can ignore this email.\n",
+			user.Name, int(constants.App.PasswordResetExpiration/time.Minute), s.config.AppURL, token,
+		),
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send reset email")
+	}
+
+	return nil
+}
+
+// ResetPassword consumes a reset token, stores the new password and logs the
+// user out of every existing session.
+func (s *PasswordResetService) ResetPassword(input ResetPasswordInput) error {
+	if input.Token == "" || input.Password == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Token and Password are required")
+	}
+
+	// Hash before consuming the token so a rejected password does not burn it
+	hashed, err := NewPasswordService(s.config).Hash(input.Password)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf(constants.Redis.PasswordResetKey, utils.HashToken(input.Token))
+
+	userID, err := s.redisClient.Client.GetDel(ctx, redisKey).Int64()
+	if errors.Is(err, goredis.Nil) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired reset token")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify reset token")
+	}
+
+	query := s.db.QB.Update("users").
+		Set(goqu.Record{"password": hashed, "updated_at": time.Now()}).
+		Where(goqu.Ex{"id": userID})
+
+	sqlQuery, args, err := query.ToSQL()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset password")
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery, args...); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reset password")
+	}
+
+	return s.authService.RevokeAllSessions(userID)
+}
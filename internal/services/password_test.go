@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// testPasswordConfig is the default policy with cheap argon2 parameters
+func testPasswordConfig() config.Password {
+	return config.Password{
+		MinLength:       10,
+		MaxLength:       128,
+		RequireUpper:    true,
+		RequireLower:    true,
+		RequireDigit:    true,
+		Argon2Time:      1,
+		Argon2MemoryKiB: 1024,
+		Argon2Threads:   1,
+	}
+}
+
+func TestPasswordValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   func(*config.Password)
+		password string
+		problems []string // Parts of the error message, none when valid
+	}{
+		{
+			name:     "valid",
+			password: "Correct1Horse",
+		},
+		{
+			name:     "too short",
+			password: "Short1a",
+			problems: []string{"at least 10 characters"},
+		},
+		{
+			name:     "length counts characters, not bytes",
+			password: "Ääääääää1x",
+		},
+		{
+			name:     "too long",
+			policy:   func(p *config.Password) { p.MaxLength = 12 },
+			password: "Correct1HorseBattery",
+			problems: []string{"at most 12 characters"},
+		},
+		{
+			name:     "every missing class is reported",
+			password: "correcthorsebattery",
+			problems: []string{"uppercase letter", "digit"},
+		},
+		{
+			name:     "missing lowercase",
+			password: "CORRECT1HORSE",
+			problems: []string{"lowercase letter"},
+		},
+		{
+			name:     "symbol required",
+			policy:   func(p *config.Password) { p.RequireSymbol = true },
+			password: "Correct1Horse",
+			problems: []string{"symbol"},
+		},
+		{
+			name:     "space counts as a symbol",
+			policy:   func(p *config.Password) { p.RequireSymbol = true },
+			password: "Correct1 Horse",
+		},
+		{
+			name: "classes not required",
+			policy: func(p *config.Password) {
+				p.RequireUpper, p.RequireLower, p.RequireDigit = false, false, false
+			},
+			password: "correcthorse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testPasswordConfig()
+			if tt.policy != nil {
+				tt.policy(&policy)
+			}
+			s := &PasswordService{config: policy}
+
+			err := s.Validate(tt.password)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Errorf("Validate(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusBadRequest {
+				t.Fatalf("Validate(%q) = %v, want a bad request", tt.password, err)
+			}
+			for _, problem := range tt.problems {
+				if !strings.Contains(fiberErr.Message, problem) {
+					t.Errorf("Validate(%q) = %q, want it to mention %q", tt.password, fiberErr.Message, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordBreachedList(t *testing.T) {
+	sum := sha1.Sum([]byte("Hashed1Password"))
+	list := strings.Join([]string{
+		"# Comments and empty lines are skipped",
+		"",
+		"Plain1Password",
+		strings.ToUpper(hex.EncodeToString(sum[:])) + ":42",
+	}, "\n")
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := testPasswordConfig()
+	policy.BreachedListFile = path
+	s := &PasswordService{config: policy}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{"Plain1Password", true},
+		{"Hashed1Password", true},
+		{"Unlisted1Password", false},
+	}
+
+	for _, tt := range tests {
+		err := s.Validate(tt.password)
+		if breached := err != nil && strings.Contains(err.Error(), "breached"); breached != tt.breached {
+			t.Errorf("Validate(%q) = %v, breached %v, want %v", tt.password, err, breached, tt.breached)
+		}
+	}
+
+	policy.BreachedListFile = filepath.Join(t.TempDir(), "missing.txt")
+	s = &PasswordService{config: policy}
+	var fiberErr *fiber.Error
+	if err := s.Validate("Unlisted1Password"); !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusInternalServerError {
+		t.Errorf("Validate with a missing breached list = %v, want an internal error", err)
+	}
+}
+
+func TestPasswordVerifyRehash(t *testing.T) {
+	s := &PasswordService{config: testPasswordConfig()}
+
+	hashed, err := s.Hash("Correct1Horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*config.Password)
+		rehash bool
+	}{
+		{name: "unchanged parameters", change: func(*config.Password) {}},
+		{name: "time cost raised", change: func(p *config.Password) { p.Argon2Time = 2 }, rehash: true},
+		{name: "memory raised", change: func(p *config.Password) { p.Argon2MemoryKiB = 2048 }, rehash: true},
+		{name: "threads raised", change: func(p *config.Password) { p.Argon2Threads = 2 }, rehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testPasswordConfig()
+			tt.change(&policy)
+			current := &PasswordService{config: policy}
+
+			ok, rehashed, err := current.Verify(hashed, "Correct1Horse")
+			if err != nil || !ok {
+				t.Fatalf("Verify = %v, %v, want a match", ok, err)
+			}
+			if (rehashed != "") != tt.rehash {
+				t.Fatalf("Verify rehashed = %q, want a new hash %v", rehashed, tt.rehash)
+			}
+			if rehashed == "" {
+				return
+			}
+
+			// The replacement matches the password and is current
+			ok, again, err := current.Verify(rehashed, "Correct1Horse")
+			if err != nil || !ok || again != "" {
+				t.Errorf("Verify(rehashed) = %v, %q, %v, want a current match", ok, again, err)
+			}
+		})
+	}
+
+	if ok, rehashed, err := s.Verify(hashed, "Wrong1Horse"); ok || rehashed != "" || err != nil {
+		t.Errorf("Verify(wrong password) = %v, %q, %v, want no match", ok, rehashed, err)
+	}
+	if _, _, err := s.Verify(utils.UnusablePassword, "Correct1Horse"); !errors.Is(err, utils.ErrUnsupportedHash) {
+		t.Errorf("Verify(unusable password) error = %v, want ErrUnsupportedHash", err)
+	}
+
+	// Runs without a stored hash and must not panic
+	s.VerifyDummy("Correct1Horse")
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/storage"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// photoKeyPrefix marks photo_url values that are storage keys rather than URLs
+const photoKeyPrefix = "storage:"
+
+// photoSizes are the variants stored for every photo, each fitting a square of
+// the given size. The largest one is what photo_url resolves to.
+var photoSizes = []struct {
+	name string
+	size int
+}{
+	{"large", 1024},
+	{"medium", 256},
+	{"small", 64},
+}
+
+// PhotoService stores profile photos and resolves photo_url to downloadable URLs
+type PhotoService struct {
+	db      *database.ECampusDB
+	storage storage.Storage
+	users   *redis.Cache[UserDetails]
+}
+
+func NewPhotoService(db *database.ECampusDB, redisDB *redis.ECampusRedisDB, store storage.Storage) *PhotoService {
+	return &PhotoService{db: db, storage: store, users: newUserCache(redisDB)}
+}
+
+// Upload validates an image, re-encodes it (dropping EXIF and any other
+// metadata) in every size and makes it the user's photo
+func (s *PhotoService) Upload(ctx context.Context, userID int64, data []byte) (*models.BaseUser, error) {
+	if len(data) > constants.App.PhotoMaxSize {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Photo must not be larger than %d MiB", constants.App.PhotoMaxSize>>20))
+	}
+
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/webp":
+	default:
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, "Photo must be a JPEG, PNG or WebP image")
+	}
+
+	// Check the dimensions before decoding so small files cannot expand into huge images
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Photo could not be read")
+	}
+	if config.Width*config.Height > constants.App.PhotoMaxPixels {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Photo dimensions are too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Photo could not be read")
+	}
+
+	token, err := utils.GenerateRandomHex(8)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store photo")
+	}
+	base := fmt.Sprintf("users/%d/photo/%s", userID, token)
+
+	// The boxes are square, so orienting after the first resize is equivalent
+	// to orienting the full image, at a fraction of the cost
+	img := orient(fit(src, photoSizes[0].size), jpegOrientation(data))
+
+	var stored []string
+	for _, variant := range photoSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fit(img, variant.size), &jpeg.Options{Quality: 85}); err != nil {
+			s.deleteKeys(stored)
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store photo")
+		}
+
+		key := photoVariantKey(base, variant.name)
+		if err := s.storage.Put(ctx, key, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+			s.deleteKeys(stored)
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store photo")
+		}
+		stored = append(stored, key)
+	}
+
+	previous, err := s.replacePhoto(userID, photoKeyPrefix+base)
+	if err != nil {
+		s.deleteKeys(stored)
+		return nil, err
+	}
+
+	s.deletePhoto(previous)
+
+	photoURL := photoKeyPrefix + base
+	user := &models.BaseUser{ID: userID, PhotoURL: &photoURL}
+	if err := s.Resolve(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// URL resolves a photo_url value to the URL of the large variant. Values that
+// are not storage keys are returned unchanged.
+func (s *PhotoService) URL(ctx context.Context, photoURL string) (string, error) {
+	user := models.BaseUser{PhotoURL: &photoURL}
+	if err := s.Resolve(ctx, &user); err != nil {
+		return "", err
+	}
+	return *user.PhotoURL, nil
+}
+
+// Resolve replaces a stored photo key with the URL of the large variant and
+// fills in the URLs of every size. Other photo_url values are left alone.
+func (s *PhotoService) Resolve(ctx context.Context, user *models.BaseUser) error {
+	if user.PhotoURL == nil {
+		return nil
+	}
+
+	base, ok := strings.CutPrefix(*user.PhotoURL, photoKeyPrefix)
+	if !ok {
+		return nil
+	}
+
+	photos := make(map[string]string, len(photoSizes))
+	for _, variant := range photoSizes {
+		url, err := s.storage.URL(ctx, photoVariantKey(base, variant.name))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to resolve photo URL")
+		}
+		photos[variant.name] = url
+	}
+
+	large := photos[photoSizes[0].name]
+	user.PhotoURL = &large
+	user.Photos = photos
+
+	return nil
+}
+
+// replacePhoto stores the new photo_url and returns the previous one
+func (s *PhotoService) replacePhoto(userID int64, photoURL string) (*string, error) {
+	sqlQuery, _, err := s.db.QB.From("users").Select("photo_url").Where(goqu.Ex{"id": userID}, notDeleted).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *string
+	if err := s.db.Conn.Get(&previous, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store photo")
+	}
+
+	sqlQuery, _, err = s.db.QB.Update("users").
+		Set(goqu.Record{"photo_url": photoURL, "updated_at": time.Now()}).
+		Where(goqu.Ex{"id": userID}, notDeleted).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store photo")
+	}
+	s.users.Delete(context.Background(), strconv.FormatInt(userID, 10))
+
+	return previous, nil
+}
+
+// RemoveDeleted deletes the stored photo of a soft deleted user and clears
+// photo_url, so the variants are not reachable after the account is gone.
+// Users that are not deleted are left alone.
+func (s *PhotoService) RemoveDeleted(userID int64) error {
+	sqlQuery, _, err := s.db.QB.From("users").
+		Select("photo_url").
+		Where(goqu.Ex{"id": userID, "deleted_at": goqu.Op{"neq": nil}}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	var photoURL *string
+	if err := s.db.Conn.Get(&photoURL, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if photoURL == nil {
+		return nil
+	}
+
+	sqlQuery, _, err = s.db.QB.Update("users").
+		Set(goqu.Record{"photo_url": nil}).
+		Where(goqu.Ex{"id": userID, "photo_url": *photoURL}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return err
+	}
+	s.users.Delete(context.Background(), strconv.FormatInt(userID, 10))
+
+	s.deletePhoto(photoURL)
+	return nil
+}
+
+// deletePhoto removes every variant of a stored photo. External photo_url
+// values are not ours to delete.
+func (s *PhotoService) deletePhoto(photoURL *string) {
+	if photoURL == nil {
+		return
+	}
+
+	base, ok := strings.CutPrefix(*photoURL, photoKeyPrefix)
+	if !ok {
+		return
+	}
+
+	keys := make([]string, len(photoSizes))
+	for i, variant := range photoSizes {
+		keys[i] = photoVariantKey(base, variant.name)
+	}
+	s.deleteKeys(keys)
+}
+
+// deleteKeys removes objects on a best effort basis; leftovers only waste space
+func (s *PhotoService) deleteKeys(keys []string) {
+	for _, key := range keys {
+		_ = s.storage.Delete(context.Background(), key)
+	}
+}
+
+func photoVariantKey(base, variant string) string {
+	return base + "/" + variant + ".jpg"
+}
+
+// fit scales an image down to fit a size x size square on a white background,
+// so transparent PNGs do not turn black as JPEG. Smaller images keep their size.
+func fit(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(height*size/width, 1)
+		} else {
+			width, height = max(width*size/height, 1), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8), since the tag itself is dropped
+// when the photo is re-encoded
+func orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, returning 1 (no
+// rotation) when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
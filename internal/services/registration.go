@@ -0,0 +1,605 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/listquery"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/mailer"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// verifyEmailPurpose namespaces signed verification links so no other signed
+// value can be replayed as one
+const verifyEmailPurpose = "verify-email"
+
+// Registration states accepted by GetRegistrations
+const (
+	RegistrationStatePending = "pending"
+	RegistrationStateExpired = "expired"
+	RegistrationStateAll     = "all"
+)
+
+type RegistrationService struct {
+	db        *database.ECampusDB
+	config    config.Config
+	mailer    mailer.Mailer
+	passwords *PasswordService
+	users     *redis.Cache[UserDetails]
+}
+
+// RegisterUserInput is a self-service sign up. Name, department and entry
+// year are taken from the admission list. The password is chosen when the
+// email is verified, so only the owner of the admitted email can set it.
+type RegisterUserInput struct {
+	Email  string `json:"email"`
+	NimNip string `json:"nim_nip"`
+}
+
+type VerifyEmailInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email"`
+}
+
+type AdmissionInput struct {
+	NimNip         string  `json:"nim_nip"`
+	Email          string  `json:"email"`
+	Name           string  `json:"name"`
+	DepartmentCode *string `json:"department_code"`
+	EntryYear      *int    `json:"entry_year"`
+}
+
+// RegistrationDetails is a registration together with the account it created
+type RegistrationDetails struct {
+	models.Registration
+	NimNip string `db:"nim_nip" json:"nim_nip"`
+	Name   string `db:"name" json:"name"`
+	Email  string `db:"email" json:"email"`
+	Status string `db:"status" json:"status"`
+}
+
+// RegistrationListSpec whitelists the fields registrations can be listed by
+var RegistrationListSpec = listquery.Spec[RegistrationDetails]{
+	Fields: map[string]listquery.Field[RegistrationDetails]{
+		"user_id":                 {Column: "registrations.user_id", Type: listquery.Int, Filter: true, Sort: true, Value: func(r RegistrationDetails) any { return r.UserID }},
+		"admission_id":            {Column: "registrations.admission_id", Type: listquery.Int, Filter: true},
+		"nim_nip":                 {Column: "users.nim_nip", Type: listquery.String, Filter: true, Sort: true, Value: func(r RegistrationDetails) any { return r.NimNip }},
+		"email":                   {Column: "users.email", Type: listquery.String, Filter: true},
+		"decision":                {Column: "registrations.decision", Type: listquery.String, Filter: true},
+		"created_at":              {Column: "registrations.created_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(r RegistrationDetails) any { return r.CreatedAt }},
+		"verification_expires_at": {Column: "registrations.verification_expires_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(r RegistrationDetails) any { return r.VerificationExpiresAt }},
+	},
+	DefaultSort:  "-created_at",
+	Key:          "user_id",
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// AdmissionListSpec whitelists the fields the admission list can be listed by
+var AdmissionListSpec = listquery.Spec[models.Admission]{
+	Fields: map[string]listquery.Field[models.Admission]{
+		"id":              {Column: "admissions.id", Type: listquery.Int, Filter: true, Sort: true, Value: func(a models.Admission) any { return a.ID }},
+		"nim_nip":         {Column: "admissions.nim_nip", Type: listquery.String, Filter: true, Sort: true, Value: func(a models.Admission) any { return a.NimNip }},
+		"name":            {Column: "admissions.name", Type: listquery.String, Filter: true, Sort: true, Value: func(a models.Admission) any { return a.Name }},
+		"email":           {Column: "admissions.email", Type: listquery.String, Filter: true},
+		"department_code": {Column: "admissions.department_code", Type: listquery.String, Filter: true},
+		"entry_year":      {Column: "admissions.entry_year", Type: listquery.Int, Filter: true},
+		"created_at":      {Column: "admissions.created_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(a models.Admission) any { return a.CreatedAt }},
+	},
+	DefaultSort:  "nim_nip",
+	Key:          "id",
+	DefaultLimit: 50,
+	MaxLimit:     500,
+}
+
+type RegistrationResponse struct {
+	Registrations []RegistrationDetails `json:"registrations"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+}
+
+type AdmissionResponse struct {
+	Admissions []models.Admission `json:"admissions"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+func NewRegistrationService(db *database.ECampusDB, redisDB *redis.ECampusRedisDB, cfg config.Config, mail mailer.Mailer) *RegistrationService {
+	return &RegistrationService{
+		db:        db,
+		config:    cfg,
+		mailer:    mail,
+		passwords: NewPasswordService(cfg),
+		users:     newUserCache(redisDB),
+	}
+}
+
+// Register creates a pending student account for an admitted student and
+// emails a verification link. The account has no usable password until the
+// link is used.
+func (s *RegistrationService) Register(input RegisterUserInput) (*RegistrationDetails, error) {
+	if input.NimNip == "" || input.Email == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "NIM and Email are required")
+	}
+
+	admission, err := s.findAdmission(input.NimNip, input.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		BaseUser: models.BaseUser{
+			ID:        utils.GenerateId(),
+			NimNip:    admission.NimNip,
+			Name:      admission.Name,
+			Email:     normalizeEmail(admission.Email),
+			Role:      models.RoleStudent,
+			Status:    models.UserStatusPendingVerification,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Password: utils.UnusablePassword,
+	}
+
+	record := goqu.Record{
+		"id":              user.ID,
+		"nim_nip":         user.NimNip,
+		"name":            user.Name,
+		"email":           user.Email,
+		"password":        user.Password,
+		"role":            user.Role,
+		"department_code": admission.DepartmentCode,
+		"entry_year":      admission.EntryYear,
+		"status":          user.Status,
+		"created_at":      now,
+		"updated_at":      now,
+	}
+
+	registration := models.Registration{
+		UserID:                user.ID,
+		AdmissionID:           admission.ID,
+		VerificationExpiresAt: now.Add(constants.App.EmailVerificationExpiration),
+		CreatedAt:             now,
+	}
+
+	userSQL, _, err := s.db.QB.Insert("users").Rows(record).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	registrationSQL, _, err := s.db.QB.Insert("registrations").Rows(registration).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	historySQL, _, err := s.db.QB.Insert("user_status_history").
+		Rows(statusHistoryRecord(user.ID, nil, user.Status, nil, now, nil)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+	defer tx.Rollback()
+
+	// Unique violations mean the student or the email already has an account
+	if _, err := tx.Exec(userSQL); err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, fiber.NewError(fiber.StatusConflict, "An account already exists for this student")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+	if _, err := tx.Exec(registrationSQL); err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, fiber.NewError(fiber.StatusConflict, "An account already exists for this student")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+	if _, err := tx.Exec(historySQL); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+
+	if err := s.sendVerification(user.ID, user.Name, user.Email, registration.VerificationExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &RegistrationDetails{
+		Registration: registration,
+		NimNip:       user.NimNip,
+		Name:         user.Name,
+		Email:        user.Email,
+		Status:       user.Status,
+	}, nil
+}
+
+// VerifyEmail activates a pending account from a signed verification link
+// and sets its password
+func (s *RegistrationService) VerifyEmail(input VerifyEmailInput) error {
+	invalid := fiber.NewError(fiber.StatusBadRequest, "Invalid or already used verification link")
+
+	if input.Password == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Password is required")
+	}
+
+	payload, err := utils.VerifySignedValue(input.Token, s.config)
+	if err != nil {
+		return invalid
+	}
+
+	parts := strings.Split(payload, "::")
+	if len(parts) != 3 || parts[0] != verifyEmailPurpose {
+		return invalid
+	}
+
+	userID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return invalid
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return invalid
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return fiber.NewError(fiber.StatusGone, "Verification link has expired")
+	}
+
+	hashed, err := s.passwords.Hash(input.Password)
+	if err != nil {
+		return err
+	}
+
+	activated, err := s.activate(userID, nil, goqu.Record{"password": hashed}, goqu.Record{"verified_at": time.Now()})
+	if err != nil {
+		return err
+	}
+	if !activated {
+		return invalid
+	}
+
+	return nil
+}
+
+// ResendVerification emails a new link to a pending registration and extends
+// its expiry. Unknown emails are ignored so the caller cannot probe accounts.
+func (s *RegistrationService) ResendVerification(input ResendVerificationInput) error {
+	if input.Email == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Email is required")
+	}
+
+	var user models.BaseUser
+	sqlQuery, _, err := s.db.QB.From("users").
+		Select("id", "name", "email").
+		Where(goqu.Ex{"email": normalizeEmail(input.Email), "status": models.UserStatusPendingVerification}, notDeleted).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Conn.Get(&user, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend verification")
+	}
+
+	expiresAt := time.Now().Add(constants.App.EmailVerificationExpiration)
+	sqlQuery, _, err = s.db.QB.Update("registrations").
+		Set(goqu.Record{"verification_expires_at": expiresAt}).
+		Where(goqu.Ex{"user_id": user.ID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend verification")
+	}
+
+	return s.sendVerification(user.ID, user.Name, user.Email, expiresAt)
+}
+
+// GetRegistrations lists registrations in a state, pending by default, with
+// query parsed by RegistrationListSpec. Expired ones are those whose
+// verification link can no longer be used.
+func (s *RegistrationService) GetRegistrations(state string, query listquery.Query) (*RegistrationResponse, error) {
+	if query.Limit < 1 {
+		query.Limit = RegistrationListSpec.DefaultLimit
+	}
+
+	dataset := s.db.QB.From("registrations").
+		Select(
+			goqu.I("registrations.*"),
+			goqu.I("users.nim_nip"),
+			goqu.I("users.name"),
+			goqu.I("users.email"),
+			goqu.I("users.status"),
+		).
+		InnerJoin(goqu.T("users"), goqu.On(goqu.Ex{"registrations.user_id": goqu.I("users.id")})).
+		Where(notDeleted)
+
+	now := time.Now()
+	switch state {
+	case "", RegistrationStatePending:
+		dataset = dataset.Where(
+			goqu.Ex{"users.status": models.UserStatusPendingVerification},
+			goqu.I("registrations.verification_expires_at").Gte(now),
+		)
+	case RegistrationStateExpired:
+		dataset = dataset.Where(
+			goqu.Ex{"users.status": models.UserStatusPendingVerification},
+			goqu.I("registrations.verification_expires_at").Lt(now),
+		)
+	case RegistrationStateAll:
+	default:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "State must be pending, expired or all")
+	}
+
+	if filters := query.Where(); len(filters) > 0 {
+		dataset = dataset.Where(filters...)
+	}
+
+	sqlQuery, _, err := query.Page(dataset).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	registrations := []RegistrationDetails{}
+	if err := s.db.Conn.Select(&registrations, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch registrations")
+	}
+
+	registrations, next := RegistrationListSpec.Next(query, registrations)
+	return &RegistrationResponse{Registrations: registrations, NextCursor: next}, nil
+}
+
+// Approve activates a pending registration without email verification. The
+// account has no password yet; the student sets one through password reset.
+func (s *RegistrationService) Approve(userID, adminID int64) error {
+	activated, err := s.activate(userID, &adminID, nil, goqu.Record{
+		"decision":    models.RegistrationApproved,
+		"reviewed_by": adminID,
+		"reviewed_at": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if !activated {
+		return fiber.NewError(fiber.StatusNotFound, "Pending registration not found")
+	}
+
+	return nil
+}
+
+// Reject closes a pending registration. The account is kept, with status
+// rejected, so the decision stays on record and it cannot log in.
+func (s *RegistrationService) Reject(userID, adminID int64) error {
+	changed, err := s.decide(userID, models.UserStatusRejected, &adminID, nil, goqu.Record{
+		"decision":    models.RegistrationRejected,
+		"reviewed_by": adminID,
+		"reviewed_at": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return fiber.NewError(fiber.StatusNotFound, "Pending registration not found")
+	}
+
+	return nil
+}
+
+// GetAdmissions lists the admission list with query parsed by AdmissionListSpec
+func (s *RegistrationService) GetAdmissions(query listquery.Query) (*AdmissionResponse, error) {
+	if query.Limit < 1 {
+		query.Limit = AdmissionListSpec.DefaultLimit
+	}
+
+	dataset := s.db.QB.From("admissions")
+	if filters := query.Where(); len(filters) > 0 {
+		dataset = dataset.Where(filters...)
+	}
+
+	sqlQuery, _, err := query.Page(dataset).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	admissions := []models.Admission{}
+	if err := s.db.Conn.Select(&admissions, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch admissions")
+	}
+
+	admissions, next := AdmissionListSpec.Next(query, admissions)
+	return &AdmissionResponse{Admissions: admissions, NextCursor: next}, nil
+}
+
+// ImportAdmissions adds entries to the admission list, updating existing
+// entries with the same NIM
+func (s *RegistrationService) ImportAdmissions(inputs []AdmissionInput) (int, error) {
+	if len(inputs) == 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "At least one admission is required")
+	}
+
+	now := time.Now()
+	rows := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		if input.NimNip == "" || input.Email == "" || input.Name == "" {
+			return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Admission %d: NIM, Email and Name are required", i+1))
+		}
+
+		rows[i] = models.Admission{
+			NimNip:         strings.TrimSpace(input.NimNip),
+			Email:          normalizeEmail(input.Email),
+			Name:           strings.TrimSpace(input.Name),
+			DepartmentCode: input.DepartmentCode,
+			EntryYear:      input.EntryYear,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("admissions").
+		Rows(rows...).
+		OnConflict(goqu.DoUpdate("nim_nip", goqu.Record{
+			"email":           goqu.I("excluded.email"),
+			"name":            goqu.I("excluded.name"),
+			"department_code": goqu.I("excluded.department_code"),
+			"entry_year":      goqu.I("excluded.entry_year"),
+			"updated_at":      now,
+		})).
+		ToSQL()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		switch pgErrorCode(err) {
+		case "23505":
+			return 0, fiber.NewError(fiber.StatusConflict, "An email is listed for more than one NIM")
+		case "23503":
+			return 0, fiber.NewError(fiber.StatusBadRequest, "Unknown department code")
+		case "21000":
+			return 0, fiber.NewError(fiber.StatusBadRequest, "A NIM is listed more than once")
+		}
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Failed to import admissions")
+	}
+
+	return len(inputs), nil
+}
+
+func (s *RegistrationService) findAdmission(nimNip, email string) (*models.Admission, error) {
+	sqlQuery, _, err := s.db.QB.From("admissions").
+		Where(
+			goqu.Ex{"nim_nip": strings.TrimSpace(nimNip)},
+			goqu.Func("LOWER", goqu.C("email")).Eq(normalizeEmail(email)),
+		).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var admission models.Admission
+	if err := s.db.Conn.Get(&admission, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "No admission matches this NIM and email")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to register")
+	}
+
+	return &admission, nil
+}
+
+func (s *RegistrationService) activate(userID int64, actorID *int64, user, registration goqu.Record) (bool, error) {
+	return s.decide(userID, models.UserStatusActive, actorID, user, registration)
+}
+
+// decide moves a pending account to status, applying any other user changes,
+// and updates its registration. It reports false when there is no pending
+// registration for the user. actorID is the reviewing admin, or nil when the
+// user verified their email.
+func (s *RegistrationService) decide(userID int64, status string, actorID *int64, user, registration goqu.Record) (bool, error) {
+	changes := goqu.Record{"status": status, "updated_at": time.Now()}
+	for column, value := range user {
+		changes[column] = value
+	}
+
+	userSQL, _, err := s.db.QB.Update("users").
+		Set(changes).
+		Where(goqu.Ex{"id": userID, "status": models.UserStatusPendingVerification}).
+		ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	registrationSQL, _, err := s.db.QB.Update("registrations").
+		Set(registration).
+		Where(goqu.Ex{"user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	pending := models.UserStatusPendingVerification
+	historySQL, _, err := s.db.QB.Insert("user_status_history").
+		Rows(statusHistoryRecord(userID, &pending, status, nil, time.Now(), actorID)).
+		ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(userSQL)
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	} else if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(registrationSQL); err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	}
+
+	if _, err := tx.Exec(historySQL); err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to update registration")
+	}
+	s.users.Delete(context.Background(), strconv.FormatInt(userID, 10))
+
+	return true, nil
+}
+
+func (s *RegistrationService) sendVerification(userID int64, name, email string, expiresAt time.Time) error {
+	token, err := utils.SignValue(fmt.Sprintf("%s::%d::%d", verifyEmailPurpose, userID, expiresAt.Unix()), s.config)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create verification link")
+	}
+
+	err = s.mailer.Send(context.Background(), mailer.Message{
+		To:      []string{email},
+		Subject: "Verify your e-campus account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nConfirm your email address and choose a password to activate your e-campus account. The link expires in %d hours.\n\n%s/verify-email?token=%s\n\nIf you did not register, you can ignore this email.\n",
+			name, int(constants.App.EmailVerificationExpiration/time.Hour), s.config.AppURL, token,
+		),
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send verification email")
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+)
+
+// roleNamePattern keeps role names usable in URLs and the users.role column
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+type RoleService struct {
+	db          *database.ECampusDB
+	permissions *redis.Cache[[]string]
+}
+
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// NewRoleService caches role permissions in Redis; without a connection
+// nothing is cached
+func NewRoleService(db *database.ECampusDB, redisDB *redis.ECampusRedisDB) *RoleService {
+	return &RoleService{
+		db:          db,
+		permissions: redis.NewCache[[]string](redisDB, "permissions", constants.Redis.PermissionsCacheKey, constants.App.PermissionsCacheExpiration),
+	}
+}
+
+func (s *RoleService) GetPermissions() ([]models.Permission, error) {
+	sqlQuery, _, err := s.db.QB.From("permissions").Order(goqu.I("name").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := []models.Permission{}
+	if err := s.db.Conn.Select(&permissions, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch permissions")
+	}
+
+	return permissions, nil
+}
+
+// GetRoles returns every role together with its permissions
+func (s *RoleService) GetRoles() ([]models.RoleDefinition, error) {
+	sqlQuery, _, err := s.db.QB.From("roles").Order(goqu.I("name").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []models.RoleDefinition{}
+	if err := s.db.Conn.Select(&roles, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch roles")
+	}
+
+	sqlQuery, _, err = s.db.QB.From("role_permissions").Order(goqu.I("permission").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []struct {
+		Role       models.Role `db:"role"`
+		Permission string      `db:"permission"`
+	}
+	if err := s.db.Conn.Select(&grants, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch roles")
+	}
+
+	byRole := make(map[models.Role][]string)
+	for _, grant := range grants {
+		byRole[grant.Role] = append(byRole[grant.Role], grant.Permission)
+	}
+
+	for i := range roles {
+		roles[i].Permissions = byRole[roles[i].Name]
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []string{}
+		}
+	}
+
+	return roles, nil
+}
+
+func (s *RoleService) GetRole(name string) (*models.RoleDefinition, error) {
+	sqlQuery, _, err := s.db.QB.From("roles").Where(goqu.Ex{"name": name}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var role models.RoleDefinition
+	if err := s.db.Conn.Get(&role, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Role not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch role")
+	}
+
+	permissions, err := s.PermissionsForRole(role.Name)
+	if err != nil {
+		return nil, err
+	}
+	role.Permissions = permissions
+
+	return &role, nil
+}
+
+// PermissionsForRole lists the permissions granted to a role
+func (s *RoleService) PermissionsForRole(role models.Role) ([]string, error) {
+	permissions, err := s.permissions.GetOrLoad(context.Background(), string(role), func() (*[]string, error) {
+		return s.loadPermissions(role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return *permissions, nil
+}
+
+func (s *RoleService) loadPermissions(role models.Role) (*[]string, error) {
+	sqlQuery, _, err := s.db.QB.From("role_permissions").
+		Select("permission").
+		Where(goqu.Ex{"role": role}).
+		Order(goqu.I("permission").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := []string{}
+	if err := s.db.Conn.Select(&permissions, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch permissions")
+	}
+
+	return &permissions, nil
+}
+
+// ValidatePermissions rejects names that are not in the permissions table
+func (s *RoleService) ValidatePermissions(permissions []string) error {
+	known, err := s.GetPermissions()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(known))
+	for _, permission := range known {
+		names[permission.Name] = true
+	}
+
+	for _, permission := range permissions {
+		if !names[permission] {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown permission: "+permission)
+		}
+	}
+
+	return nil
+}
+
+func (s *RoleService) CreateRole(input RoleInput) (*models.RoleDefinition, error) {
+	if !roleNamePattern.MatchString(input.Name) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Role name must be 2-50 lowercase letters, digits, '-' or '_'")
+	}
+
+	if err := s.ValidatePermissions(input.Permissions); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	insertSQL, _, err := s.db.QB.Insert("roles").
+		Rows(goqu.Record{"name": input.Name, "description": input.Description, "created_at": now, "updated_at": now}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create role")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(insertSQL); err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, fiber.NewError(fiber.StatusConflict, "Role already exists")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create role")
+	}
+
+	if err := s.replacePermissions(tx, input.Name, input.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create role")
+	}
+	s.permissions.Delete(context.Background(), input.Name)
+
+	return s.GetRole(input.Name)
+}
+
+// UpdateRole replaces the description and the full permission set of a role
+func (s *RoleService) UpdateRole(name string, input RoleInput) (*models.RoleDefinition, error) {
+	if err := s.ValidatePermissions(input.Permissions); err != nil {
+		return nil, err
+	}
+
+	// Keep at least one role able to manage roles
+	if models.Role(name) == models.RoleAdmin && !models.Scopes(input.Permissions).Has(constants.Permissions.RolesManage) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "The admin role must keep the "+constants.Permissions.RolesManage+" permission")
+	}
+
+	updateSQL, _, err := s.db.QB.Update("roles").
+		Set(goqu.Record{"description": input.Description, "updated_at": time.Now()}).
+		Where(goqu.Ex{"name": name}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update role")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(updateSQL)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update role")
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update role")
+	} else if rowsAffected == 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Role not found")
+	}
+
+	if err := s.replacePermissions(tx, name, input.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to update role")
+	}
+	s.permissions.Delete(context.Background(), name)
+
+	return s.GetRole(name)
+}
+
+// DeleteRole removes a custom role. Roles still assigned to users are kept.
+func (s *RoleService) DeleteRole(name string) error {
+	role, err := s.GetRole(name)
+	if err != nil {
+		return err
+	}
+
+	if role.IsSystem {
+		return fiber.NewError(fiber.StatusBadRequest, "Built-in roles cannot be deleted")
+	}
+
+	sqlQuery, _, err := s.db.QB.Delete("roles").Where(goqu.Ex{"name": name}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		if pgErrorCode(err) == "23503" {
+			return fiber.NewError(fiber.StatusConflict, "Role is still assigned to users")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete role")
+	}
+
+	s.permissions.Delete(context.Background(), name)
+	return nil
+}
+
+func (s *RoleService) replacePermissions(tx *sqlx.Tx, role string, permissions []string) error {
+	deleteSQL, _, err := s.db.QB.Delete("role_permissions").Where(goqu.Ex{"role": role}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(deleteSQL); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store role permissions")
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	rows := make([]interface{}, len(permissions))
+	for i, permission := range permissions {
+		rows[i] = goqu.Record{"role": role, "permission": permission}
+	}
+
+	insertSQL, _, err := s.db.QB.Insert("role_permissions").Rows(rows...).OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(insertSQL); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store role permissions")
+	}
+
+	return nil
+}
+
+// pgErrorCode returns the SQLSTATE of a Postgres error, or "" for other errors
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// pgConstraintName returns the constraint a PostgreSQL error was raised for
+func pgConstraintName(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
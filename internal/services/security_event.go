@@ -0,0 +1,29 @@
+package services
+
+import (
+	"time"
+
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+)
+
+type SecurityEventService struct {
+	db *database.ECampusDB
+}
+
+func NewSecurityEventService(db *database.ECampusDB) *SecurityEventService {
+	return &SecurityEventService{db: db}
+}
+
+// Record appends an event to the security log
+func (s *SecurityEventService) Record(event models.SecurityEvent) error {
+	event.CreatedAt = time.Now()
+
+	sqlQuery, args, err := s.db.QB.Insert("security_events").Rows(event).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Conn.Exec(sqlQuery, args...)
+	return err
+}
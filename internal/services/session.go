@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// ClientInfo describes the client a session was created from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// Session is the metadata stored in Redis for every login
+type Session struct {
+	ID        int64     `json:"id,string"`
+	UserID    int64     `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	// ExpiresAt is the absolute end of the session. Until then every use
+	// extends it by IdleTimeoutSeconds.
+	ExpiresAt          time.Time `json:"expires_at"`
+	IdleTimeoutSeconds int64     `json:"idle_timeout_seconds"`
+
+	// ImpersonatorID is the admin acting as the user in an impersonation session
+	ImpersonatorID *int64 `json:"impersonator_id,omitempty"`
+}
+
+// ttl is how long the session may stay unused from now on, never past ExpiresAt
+func (session *Session) ttl(now time.Time) time.Duration {
+	ttl := time.Duration(session.IdleTimeoutSeconds) * time.Second
+	if remaining := session.ExpiresAt.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	return ttl
+}
+
+// putSessionScript stores a session and adds it to the user's index in one
+// atomic step, so concurrent logins cannot both see room under the limit.
+// Before inserting, index entries whose session expired are dropped and the
+// oldest live sessions are evicted until at most ARGV[1] remain (none when it
+// is negative). The index TTL only ever grows, so it outlives the longest
+// session it lists.
+//
+// Every key the script touches is declared: KEYS[1] is the index, KEYS[2] and
+// KEYS[3] the new session and refresh keys, followed by the session and
+// refresh key of each index member the caller read, listed again in ARGV[8..].
+// If the index no longer holds exactly those members the script changes
+// nothing and returns {"changed"}; otherwise it returns "ok" followed by the
+// evicted session ids. The keys of a user do not share a hash slot, so this
+// needs a single-node Redis, not Redis Cluster.
+//
+// ARGV: keep, session id, session data, refresh id ("" for none), session TTL
+// and index TTL in milliseconds, the index score, then the members read.
+var putSessionScript = goredis.NewScript(`
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+if #members ~= #ARGV - 7 then
+	return {'changed'}
+end
+for i, member in ipairs(members) do
+	if member ~= ARGV[7 + i] then
+		return {'changed'}
+	end
+end
+
+local result = {'ok'}
+local keep = tonumber(ARGV[1])
+if keep >= 0 then
+	local live = {}
+	for i, member in ipairs(members) do
+		if redis.call('EXISTS', KEYS[2 + 2 * i]) == 1 then
+			table.insert(live, i)
+		else
+			redis.call('ZREM', KEYS[1], member)
+		end
+	end
+
+	for j = 1, #live - keep do
+		local i = live[j]
+		redis.call('DEL', KEYS[2 + 2 * i], KEYS[3 + 2 * i])
+		redis.call('ZREM', KEYS[1], members[i])
+		table.insert(result, members[i])
+	end
+end
+
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[5])
+if ARGV[4] ~= '' then
+	redis.call('SET', KEYS[3], ARGV[4], 'PX', ARGV[5])
+end
+redis.call('ZADD', KEYS[1], ARGV[7], ARGV[2])
+
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[6]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[6])
+end
+
+return result
+`)
+
+// putSessionAttempts bounds how often putSession rereads an index that other
+// logins keep changing
+const putSessionAttempts = 5
+
+// putSession runs putSessionScript for a session of userID and returns the
+// ids of the sessions evicted to make room for it
+func (s *AuthService) putSession(userID int64, session Session, refreshID string, keep int, ttl, indexTTL time.Duration) ([]int64, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	indexKey := fmt.Sprintf(constants.Redis.UserSessionsKey, userID)
+
+	for attempt := 0; attempt < putSessionAttempts; attempt++ {
+		members, err := s.redisClient.Client.ZRange(ctx, indexKey, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []string{
+			indexKey,
+			fmt.Sprintf(constants.Redis.SessionKey, userID, session.ID),
+			fmt.Sprintf(constants.Redis.RefreshTokenKey, userID, session.ID),
+		}
+		args := []interface{}{keep, session.ID, data, refreshID, ttl.Milliseconds(), indexTTL.Milliseconds(), session.CreatedAt.Unix()}
+		for _, member := range members {
+			memberID, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys,
+				fmt.Sprintf(constants.Redis.SessionKey, userID, memberID),
+				fmt.Sprintf(constants.Redis.RefreshTokenKey, userID, memberID),
+			)
+			args = append(args, member)
+		}
+
+		result, err := putSessionScript.Run(ctx, s.redisClient.Client, keys, args...).StringSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(result) == 0 || result[0] != "ok" {
+			continue
+		}
+
+		evicted := make([]int64, 0, len(result)-1)
+		for _, member := range result[1:] {
+			if sessionID, err := strconv.ParseInt(member, 10, 64); err == nil {
+				evicted = append(evicted, sessionID)
+			}
+		}
+		return evicted, nil
+	}
+
+	return nil, errors.New("session index kept changing while storing a session")
+}
+
+// ListSessions returns the live sessions of a user, oldest first
+func (s *AuthService) ListSessions(userID int64) ([]Session, error) {
+	ctx := context.Background()
+	indexKey := fmt.Sprintf(constants.Redis.UserSessionsKey, userID)
+
+	members, err := s.redisClient.Client.ZRange(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to list sessions")
+	}
+
+	sessions := make([]Session, 0, len(members))
+	for _, member := range members {
+		sessionID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		session, err := s.loadSession(userID, sessionID)
+		if errors.Is(err, errSessionNotFound) {
+			// The session expired on its own, drop it from the index
+			s.redisClient.Client.ZRem(ctx, indexKey, member)
+			continue
+		}
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to list sessions")
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs out a single session belonging to the user
+func (s *AuthService) RevokeSession(userID, sessionID int64) error {
+	if _, err := s.loadSession(userID, sessionID); err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Session not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke session")
+	}
+
+	return s.revokeSession(userID, sessionID)
+}
+
+// RevokeAllSessions logs the user out everywhere
+func (s *AuthService) RevokeAllSessions(userID int64) error {
+	ctx := context.Background()
+	indexKey := fmt.Sprintf(constants.Redis.UserSessionsKey, userID)
+
+	members, err := s.redisClient.Client.ZRange(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	keys := make([]string, 0, len(members)*2+1)
+	for _, member := range members {
+		sessionID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		keys = append(keys,
+			fmt.Sprintf(constants.Redis.SessionKey, userID, sessionID),
+			fmt.Sprintf(constants.Redis.RefreshTokenKey, userID, sessionID),
+		)
+	}
+	keys = append(keys, indexKey)
+
+	if err := s.redisClient.Client.Del(ctx, keys...).Err(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	return nil
+}
+
+func (s *AuthService) storeSession(user models.User, sessionID, refreshID int64, client ClientInfo) error {
+	limits, err := s.sessionLimits(user.Role)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		CreatedAt: now,
+		LastSeen:  now,
+
+		ExpiresAt:          now.Add(limits.absoluteTimeout),
+		IdleTimeoutSeconds: int64(limits.idleTimeout.Seconds()),
+	}
+
+	// The session and its refresh token expire together once the session is
+	// idle; the index outlives every session it lists. A limit of 0 keeps -1
+	// older sessions, which the script treats as no limit.
+	evicted, err := s.putSession(user.ID, session, strconv.FormatInt(refreshID, 10), limits.maxSessions-1, limits.idleTimeout, limits.absoluteTimeout)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store session ID")
+	}
+
+	for _, evictedID := range evicted {
+		s.logSecurityEvent(models.SecurityEvent{
+			EventType: models.SecurityEventSessionEvicted,
+			UserID:    &user.ID,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   fmt.Sprintf("session %d", evictedID),
+		})
+	}
+
+	return nil
+}
+
+func (s *AuthService) loadSession(userID, sessionID int64) (*Session, error) {
+	redisKey := fmt.Sprintf(constants.Redis.SessionKey, userID, sessionID)
+
+	data, err := s.redisClient.Client.Get(context.Background(), redisKey).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, errSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+
+	// Sessions stored before lifetimes were tracked get the defaults
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = session.CreatedAt.Add(s.config.Session.AbsoluteTimeout)
+	}
+	if session.IdleTimeoutSeconds == 0 {
+		session.IdleTimeoutSeconds = int64(s.config.Session.IdleTimeout.Seconds())
+	}
+
+	return &session, nil
+}
+
+// touchSession records the last time a session was used and slides its idle
+// expiration. Writes are throttled so busy clients do not hit Redis on every
+// request.
+func (s *AuthService) touchSession(session *Session) error {
+	now := time.Now()
+	if now.Sub(session.LastSeen) < constants.App.SessionTouchInterval {
+		return nil
+	}
+
+	session.LastSeen = now
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update session")
+	}
+
+	ctx := context.Background()
+	ttl := session.ttl(now)
+	redisKey := fmt.Sprintf(constants.Redis.SessionKey, session.UserID, session.ID)
+	refreshKey := fmt.Sprintf(constants.Redis.RefreshTokenKey, session.UserID, session.ID)
+
+	_, err = s.redisClient.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.SetXX(ctx, redisKey, data, ttl)
+		pipe.Expire(ctx, refreshKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update session")
+	}
+
+	return nil
+}
+
+// revokeSession removes a session together with its refresh token
+func (s *AuthService) revokeSession(userID, sessionID int64) error {
+	ctx := context.Background()
+	redisKey := fmt.Sprintf(constants.Redis.SessionKey, userID, sessionID)
+	refreshKey := fmt.Sprintf(constants.Redis.RefreshTokenKey, userID, sessionID)
+	indexKey := fmt.Sprintf(constants.Redis.UserSessionsKey, userID)
+
+	_, err := s.redisClient.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, redisKey, refreshKey)
+		pipe.ZRem(ctx, indexKey, sessionID)
+		return nil
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke session")
+	}
+
+	return nil
+}
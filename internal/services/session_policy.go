@@ -0,0 +1,124 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+)
+
+// SessionPolicyInput overrides the session lifetimes of a role. Omitted or
+// null fields use the configured defaults.
+type SessionPolicyInput struct {
+	IdleTimeoutSeconds     *int `json:"idle_timeout_seconds"`
+	AbsoluteTimeoutSeconds *int `json:"absolute_timeout_seconds"`
+	MaxSessions            *int `json:"max_sessions"`
+}
+
+// sessionLimits are the effective lifetimes applied to a new session
+type sessionLimits struct {
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	maxSessions     int
+}
+
+func (s *AuthService) GetSessionPolicies() ([]models.SessionPolicy, error) {
+	sqlQuery, _, err := s.db.QB.From("session_policies").Order(goqu.I("role").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []models.SessionPolicy{}
+	if err := s.db.Conn.Select(&policies, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch policies")
+	}
+
+	return policies, nil
+}
+
+// SetSessionPolicy replaces the session overrides of a role. Existing sessions
+// keep the lifetimes they were created with.
+func (s *AuthService) SetSessionPolicy(role string, input SessionPolicyInput) error {
+	if (input.IdleTimeoutSeconds != nil && *input.IdleTimeoutSeconds <= 0) ||
+		(input.AbsoluteTimeoutSeconds != nil && *input.AbsoluteTimeoutSeconds <= 0) {
+		return fiber.NewError(fiber.StatusBadRequest, "Timeouts must be positive")
+	}
+	if input.MaxSessions != nil && *input.MaxSessions < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Max sessions must not be negative")
+	}
+	if input.IdleTimeoutSeconds != nil && input.AbsoluteTimeoutSeconds != nil && *input.IdleTimeoutSeconds > *input.AbsoluteTimeoutSeconds {
+		return fiber.NewError(fiber.StatusBadRequest, "Idle timeout must not exceed the absolute timeout")
+	}
+
+	record := goqu.Record{
+		"idle_timeout_seconds":     input.IdleTimeoutSeconds,
+		"absolute_timeout_seconds": input.AbsoluteTimeoutSeconds,
+		"max_sessions":             input.MaxSessions,
+		"updated_at":               time.Now(),
+	}
+
+	insert := goqu.Record{"role": role}
+	for column, value := range record {
+		insert[column] = value
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("session_policies").
+		Rows(insert).
+		OnConflict(goqu.DoUpdate("role", record)).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		if pgErrorCode(err) == "23503" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid role")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update policy")
+	}
+
+	return nil
+}
+
+// sessionLimits resolves the lifetimes for a role from its policy and the
+// configured defaults
+func (s *AuthService) sessionLimits(role models.Role) (sessionLimits, error) {
+	limits := sessionLimits{
+		idleTimeout:     s.config.Session.IdleTimeout,
+		absoluteTimeout: s.config.Session.AbsoluteTimeout,
+		maxSessions:     s.config.Session.MaxConcurrent,
+	}
+
+	sqlQuery, _, err := s.db.QB.From("session_policies").Where(goqu.Ex{"role": role}).ToSQL()
+	if err != nil {
+		return limits, err
+	}
+
+	var policy models.SessionPolicy
+	if err := s.db.Conn.Get(&policy, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return limits, nil
+		}
+		return limits, fiber.NewError(fiber.StatusInternalServerError, "Failed to load session policy")
+	}
+
+	if policy.IdleTimeoutSeconds != nil {
+		limits.idleTimeout = time.Duration(*policy.IdleTimeoutSeconds) * time.Second
+	}
+	if policy.AbsoluteTimeoutSeconds != nil {
+		limits.absoluteTimeout = time.Duration(*policy.AbsoluteTimeoutSeconds) * time.Second
+	}
+	if policy.MaxSessions != nil {
+		limits.maxSessions = *policy.MaxSessions
+	}
+
+	// An override of only one timeout can leave idle above absolute
+	if limits.idleTimeout > limits.absoluteTimeout {
+		limits.idleTimeout = limits.absoluteTimeout
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// sqlBuilder is implemented by every goqu dataset
+type sqlBuilder interface {
+	ToSQL() (string, []interface{}, error)
+}
+
+type TwoFactorService struct {
+	db          *database.ECampusDB
+	redisClient *redis.ECampusRedisDB
+	config      config.Config
+	authService *AuthService
+}
+
+type TwoFactorCodeInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type TwoFactorPolicyInput struct {
+	Required bool `json:"required"`
+}
+
+// TwoFactorSetup is returned when enrollment starts; the secret is only shown once
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorEnrollment is returned once the first code has been verified
+type TwoFactorEnrollment struct {
+	*AuthTokens
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewTwoFactorService(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, authService *AuthService) *TwoFactorService {
+	return &TwoFactorService{
+		db:          db,
+		redisClient: redisClient,
+		config:      cfg,
+		authService: authService,
+	}
+}
+
+// Setup generates a new secret for a user who has not enabled 2FA yet
+func (s *TwoFactorService) Setup(userID int64, email string) (*TwoFactorSetup, error) {
+	current, err := s.getTwoFactor(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load two-factor settings")
+	}
+	if current != nil && current.EnabledAt != nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate secret")
+	}
+
+	encrypted, err := utils.EncryptSecret(secret, s.config)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate secret")
+	}
+
+	now := time.Now()
+	query := s.db.QB.Insert("user_two_factor").
+		Rows(goqu.Record{"user_id": userID, "secret": encrypted, "created_at": now, "updated_at": now}).
+		OnConflict(goqu.DoUpdate("user_id", goqu.Record{"secret": encrypted, "last_used_step": 0, "updated_at": now}))
+
+	if err := s.exec(query); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store secret")
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: utils.TOTPProvisioningURI(constants.App.TwoFactorIssuer, email, secret),
+	}, nil
+}
+
+// Enable verifies the first code from the authenticator app, switches 2FA on
+// and returns a fresh set of recovery codes
+func (s *TwoFactorService) Enable(userID int64, code string) ([]string, error) {
+	current, err := s.getTwoFactor(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Two-factor setup has not been started")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load two-factor settings")
+	}
+	if current.EnabledAt != nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	ok, err := s.verifyTOTP(current, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid two-factor code")
+	}
+
+	query := s.db.QB.Update("user_two_factor").
+		Set(goqu.Record{"enabled_at": time.Now(), "updated_at": time.Now()}).
+		Where(goqu.Ex{"user_id": userID})
+
+	if err := s.exec(query); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to enable two-factor authentication")
+	}
+
+	return s.replaceRecoveryCodes(userID)
+}
+
+// Disable turns 2FA off after checking a current code. Roles with a mandatory
+// policy cannot opt out.
+func (s *TwoFactorService) Disable(user *UserDetails, code string) error {
+	_, required, err := s.authService.twoFactorState(models.User{BaseUser: user.BaseUser})
+	if err != nil {
+		return err
+	}
+	if required {
+		return fiber.NewError(fiber.StatusForbidden, "Two-factor authentication is mandatory for your role")
+	}
+
+	if err := s.verifyCode(user.ID, code); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"user_recovery_codes", "user_two_factor"} {
+		if err := s.exec(s.db.QB.Delete(table).Where(goqu.Ex{"user_id": user.ID})); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to disable two-factor authentication")
+		}
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes invalidates all previous recovery codes
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	if err := s.verifyCode(userID, code); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(userID)
+}
+
+// VerifyChallenge completes a login that was paused for a second factor
+func (s *TwoFactorService) VerifyChallenge(input TwoFactorCodeInput, client ClientInfo) (*AuthTokens, error) {
+	user, err := s.challengeUser(input.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.checkLoginAllowed(user.Email, client.IP); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyCode(user.ID, input.Code); err != nil {
+		s.failChallenge(input.ChallengeToken, user, client)
+		return nil, err
+	}
+
+	s.consumeChallenge(input.ChallengeToken)
+	tokens, err := s.authService.createSession(*user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.authService.resetLoginFailures(user.Email)
+	return tokens, nil
+}
+
+// SetupWithChallenge lets a user whose role requires 2FA enroll during login
+func (s *TwoFactorService) SetupWithChallenge(challengeToken string) (*TwoFactorSetup, error) {
+	user, err := s.challengeUser(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Setup(user.ID, user.Email)
+}
+
+// EnableWithChallenge finishes enrollment during login and creates the session
+func (s *TwoFactorService) EnableWithChallenge(input TwoFactorCodeInput, client ClientInfo) (*TwoFactorEnrollment, error) {
+	user, err := s.challengeUser(input.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.checkLoginAllowed(user.Email, client.IP); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.Enable(user.ID, input.Code)
+	if err != nil {
+		s.failChallenge(input.ChallengeToken, user, client)
+		return nil, err
+	}
+
+	s.consumeChallenge(input.ChallengeToken)
+	tokens, err := s.authService.createSession(*user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.authService.resetLoginFailures(user.Email)
+
+	return &TwoFactorEnrollment{AuthTokens: tokens, RecoveryCodes: codes}, nil
+}
+
+func (s *TwoFactorService) GetPolicies() ([]models.TwoFactorPolicy, error) {
+	sqlQuery, _, err := s.db.QB.From("two_factor_policies").Order(goqu.I("role").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []models.TwoFactorPolicy{}
+	if err := s.db.Conn.Select(&policies, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// SetPolicy makes 2FA mandatory (or optional again) for every user of a role
+func (s *TwoFactorService) SetPolicy(role string, required bool) error {
+	now := time.Now()
+	query := s.db.QB.Insert("two_factor_policies").
+		Rows(goqu.Record{"role": role, "required": required, "updated_at": now}).
+		OnConflict(goqu.DoUpdate("role", goqu.Record{"required": required, "updated_at": now}))
+
+	if err := s.exec(query); err != nil {
+		if pgErrorCode(err) == "23503" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid role")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update policy")
+	}
+
+	return nil
+}
+
+// verifyCode accepts either a TOTP code or an unused recovery code
+func (s *TwoFactorService) verifyCode(userID int64, code string) error {
+	current, err := s.getTwoFactor(userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && current.EnabledAt == nil) {
+		return fiber.NewError(fiber.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load two-factor settings")
+	}
+
+	ok, err := s.verifyTOTP(current, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	ok, err = s.useRecoveryCode(userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid two-factor code")
+	}
+
+	return nil
+}
+
+// verifyTOTP checks the code and atomically advances last_used_step so the
+// same code cannot be used twice
+func (s *TwoFactorService) verifyTOTP(current *models.UserTwoFactor, code string) (bool, error) {
+	secret, err := utils.DecryptSecret(current.Secret, s.config)
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to read two-factor secret")
+	}
+
+	step, ok := utils.VerifyTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok || step <= current.LastUsedStep {
+		return false, nil
+	}
+
+	query := s.db.QB.Update("user_two_factor").
+		Set(goqu.Record{"last_used_step": step, "updated_at": time.Now()}).
+		Where(goqu.Ex{"user_id": current.UserID, "last_used_step": goqu.Op{"lt": step}})
+
+	return s.execAffected(query)
+}
+
+func (s *TwoFactorService) useRecoveryCode(userID int64, code string) (bool, error) {
+	normalized := strings.ToLower(strings.TrimSpace(code))
+	if normalized == "" {
+		return false, nil
+	}
+
+	query := s.db.QB.Update("user_recovery_codes").
+		Set(goqu.Record{"used_at": time.Now()}).
+		Where(
+			goqu.Ex{"user_id": userID, "code_hash": utils.HashToken(normalized)},
+			goqu.C("used_at").IsNull(),
+		)
+
+	return s.execAffected(query)
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, constants.App.RecoveryCodeCount)
+	rows := make([]interface{}, constants.App.RecoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate recovery codes")
+		}
+		codes[i] = code
+		rows[i] = goqu.Record{"user_id": userID, "code_hash": utils.HashToken(code), "created_at": time.Now()}
+	}
+
+	deleteSQL, _, err := s.db.QB.Delete("user_recovery_codes").Where(goqu.Ex{"user_id": userID}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	insertSQL, _, err := s.db.QB.Insert("user_recovery_codes").Rows(rows...).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store recovery codes")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteSQL); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store recovery codes")
+	}
+	if _, err := tx.Exec(insertSQL); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store recovery codes")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store recovery codes")
+	}
+
+	return codes, nil
+}
+
+// ReencryptSecrets moves every stored TOTP secret to the active data key so
+// older keys can be dropped. It returns the number of secrets rewritten.
+func (s *TwoFactorService) ReencryptSecrets() (int, error) {
+	activeID, _, err := s.config.ActiveDataKey()
+	if err != nil {
+		return 0, err
+	}
+
+	sqlQuery, _, err := s.db.QB.From("user_two_factor").Select("user_id", "secret").ToSQL()
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []models.UserTwoFactor
+	if err := s.db.Conn.Select(&rows, sqlQuery); err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, row := range rows {
+		secret, err := utils.DecryptSecret(row.Secret, s.config)
+		if err != nil {
+			return rewritten, fmt.Errorf("user %d: %w", row.UserID, err)
+		}
+		if utils.SecretKeyID(row.Secret) == activeID {
+			continue
+		}
+
+		encrypted, err := utils.EncryptSecret(secret, s.config)
+		if err != nil {
+			return rewritten, err
+		}
+
+		// The secret is compared too so a concurrent re-enrollment is not overwritten
+		updateQuery, _, err := s.db.QB.Update("user_two_factor").
+			Set(goqu.Record{"secret": encrypted}).
+			Where(goqu.Ex{"user_id": row.UserID, "secret": row.Secret}).
+			ToSQL()
+		if err != nil {
+			return rewritten, err
+		}
+		if _, err := s.db.Conn.Exec(updateQuery); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+
+	return rewritten, nil
+}
+
+func (s *TwoFactorService) getTwoFactor(userID int64) (*models.UserTwoFactor, error) {
+	sqlQuery, _, err := s.db.QB.From("user_two_factor").Where(goqu.Ex{"user_id": userID}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var twoFactor models.UserTwoFactor
+	if err := s.db.Conn.Get(&twoFactor, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return &twoFactor, nil
+}
+
+// challengeUser resolves the user a login challenge was issued for
+func (s *TwoFactorService) challengeUser(challengeToken string) (*models.User, error) {
+	if challengeToken == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Challenge token is required")
+	}
+
+	redisKey := fmt.Sprintf(constants.Redis.TwoFactorChallengeKey, utils.HashToken(challengeToken))
+	userID, err := s.redisClient.Client.HGet(context.Background(), redisKey, "user_id").Int64()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired challenge")
+	}
+
+	user, err := s.authService.getUserByIDFromDB(userID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired challenge")
+	}
+
+	return &user, nil
+}
+
+// failChallenge counts a wrong code and drops the challenge after too many.
+// The attempt also counts as a failed login, so requesting new challenges
+// with a known password cannot get around the lockout.
+func (s *TwoFactorService) failChallenge(challengeToken string, user *models.User, client ClientInfo) {
+	s.authService.recordLoginFailure(user.Email, &user.ID, client)
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf(constants.Redis.TwoFactorChallengeKey, utils.HashToken(challengeToken))
+
+	attempts, err := s.redisClient.Client.HIncrBy(ctx, redisKey, "attempts", 1).Result()
+	if err == nil && attempts >= constants.App.TwoFactorMaxAttempts {
+		s.redisClient.Client.Del(ctx, redisKey)
+	}
+}
+
+func (s *TwoFactorService) consumeChallenge(challengeToken string) {
+	redisKey := fmt.Sprintf(constants.Redis.TwoFactorChallengeKey, utils.HashToken(challengeToken))
+	s.redisClient.Client.Del(context.Background(), redisKey)
+}
+
+func (s *TwoFactorService) exec(query sqlBuilder) error {
+	sqlQuery, args, err := query.ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Conn.Exec(sqlQuery, args...)
+	return err
+}
+
+func (s *TwoFactorService) execAffected(query sqlBuilder) (bool, error) {
+	sqlQuery, args, err := query.ToSQL()
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to verify two-factor code")
+	}
+
+	result, err := s.db.Conn.Exec(sqlQuery, args...)
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to verify two-factor code")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to verify two-factor code")
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// twoFactorState reports whether the user has enabled 2FA and whether their
+// role requires it
+func (s *AuthService) twoFactorState(user models.User) (bool, bool, error) {
+	var state struct {
+		Enabled  bool `db:"enabled"`
+		Required bool `db:"required"`
+	}
+
+	query := s.db.QB.Select(
+		goqu.L("EXISTS (?)", s.db.QB.From("user_two_factor").
+			Select(goqu.L("1")).
+			Where(goqu.Ex{"user_id": user.ID}, goqu.C("enabled_at").IsNotNull()),
+		).As("enabled"),
+		goqu.L("EXISTS (?)", s.db.QB.From("two_factor_policies").
+			Select(goqu.L("1")).
+			Where(goqu.Ex{"role": string(user.Role), "required": true}),
+		).As("required"),
+	)
+
+	sqlQuery, _, err := query.ToSQL()
+	if err != nil {
+		return false, false, fiber.NewError(fiber.StatusInternalServerError, "Failed to check two-factor settings")
+	}
+
+	if err := s.db.Conn.Get(&state, sqlQuery); err != nil {
+		return false, false, fiber.NewError(fiber.StatusInternalServerError, "Failed to check two-factor settings")
+	}
+
+	return state.Enabled, state.Required, nil
+}
+
+// createTwoFactorChallenge stores a short-lived token that stands in for the
+// password step until the second factor is verified
+func (s *AuthService) createTwoFactorChallenge(userID int64) (string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to create challenge")
+	}
+
+	ctx := context.Background()
+	redisKey := fmt.Sprintf(constants.Redis.TwoFactorChallengeKey, utils.HashToken(token))
+
+	_, err = s.redisClient.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, redisKey, "user_id", userID, "attempts", 0)
+		pipe.Expire(ctx, redisKey, constants.App.TwoFactorChallengeExpiration)
+		return nil
+	})
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to create challenge")
+	}
+
+	return token, nil
+}
@@ -1,79 +1,205 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jmoiron/sqlx"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
 	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/listquery"
 	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
 )
 
+// ErrPasswordNotHashed is returned when a password would be stored without
+// being hashed first
+var ErrPasswordNotHashed = errors.New("password must be an argon2 hash")
+
+// ErrUserNotDeleted is returned when purging a user that was not deleted first
+var ErrUserNotDeleted = errors.New("user must be deleted before it can be purged")
+
+// notDeleted excludes soft-deleted users. Every user query applies it unless
+// deleted users are asked for explicitly.
+var notDeleted = goqu.Ex{"users.deleted_at": nil}
+
 type UserService struct {
-	db *database.ECampusDB
+	db    *database.ECampusDB
+	cache *redis.Cache[UserDetails]
+}
+
+// NewUserService caches user details in Redis; without a connection nothing
+// is cached
+func NewUserService(db *database.ECampusDB, redisDB *redis.ECampusRedisDB) *UserService {
+	return &UserService{db: db, cache: newUserCache(redisDB)}
 }
 
-func NewUserService(db *database.ECampusDB) *UserService {
-	return &UserService{db: db}
+// newUserCache caches GetUserByID, which runs on every authenticated request.
+// Every write to a user evicts it; the study plan columns can lag behind by
+// up to the TTL.
+func newUserCache(redisDB *redis.ECampusRedisDB) *redis.Cache[UserDetails] {
+	return redis.NewCache[UserDetails](redisDB, "users", constants.Redis.UserCacheKey, constants.App.UserCacheExpiration)
+}
+
+// UserListSpec whitelists the fields users can be listed by. Status,
+// department and entry year are nullable, so they can be filtered but not
+// sorted.
+var UserListSpec = listquery.Spec[models.BaseUser]{
+	Fields: map[string]listquery.Field[models.BaseUser]{
+		"id":              {Column: "users.id", Type: listquery.Int, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.ID }},
+		"name":            {Column: "users.name", Type: listquery.String, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.Name }},
+		"email":           {Column: "users.email", Type: listquery.String, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.Email }},
+		"nim_nip":         {Column: "users.nim_nip", Type: listquery.String, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.NimNip }},
+		"role":            {Column: "users.role", Type: listquery.String, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return string(u.Role) }},
+		"created_at":      {Column: "users.created_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.CreatedAt }},
+		"updated_at":      {Column: "users.updated_at", Type: listquery.Time, Filter: true, Sort: true, Value: func(u models.BaseUser) any { return u.UpdatedAt }},
+		"status":          {Column: "users.status", Type: listquery.String, Filter: true},
+		"department_code": {Column: "users.department_code", Type: listquery.String, Filter: true},
+		"entry_year":      {Column: "users.entry_year", Type: listquery.Int, Filter: true},
+	},
+	DefaultSort:  "id",
+	Key:          "id",
+	DefaultLimit: 10,
+	MaxLimit:     100,
 }
 
 type UserFilters struct {
-	Limit   int
-	Offset  int
-	Filters map[string]interface{}
+	Query          listquery.Query // Parsed with UserListSpec
+	IncludeDeleted bool
+	Search         string // Matched against name, email and NIM/NIP; ranked by relevance unless sorted explicitly
+}
+
+// rankSearch reports whether results are ordered by search relevance, which
+// cannot be paged with a cursor
+func (params UserFilters) rankSearch() bool {
+	return params.Search != "" && !params.Query.Sorted
 }
 
+// UserResponse is a page of users. NextCursor is empty on the last page and
+// for relevance ranked searches; the page numbers are left out when paging
+// with a cursor.
 type UserResponse struct {
-	Users       []models.User `json:"users"`
-	TotalCount  int64         `json:"total_count"`
-	TotalPages  int64         `json:"total_pages"`
-	CurrentPage int           `json:"current_page"`
+	Users       []models.BaseUser `json:"users"`
+	TotalCount  int64             `json:"total_count"`
+	TotalPages  int64             `json:"total_pages,omitempty"`
+	CurrentPage int               `json:"current_page,omitempty"`
+	NextCursor  string            `json:"next_cursor,omitempty"`
 }
 
 func (s *UserService) GetUsers(params UserFilters) (*UserResponse, error) {
-	users, err := s.fetchUsers(params)
+	if params.Query.Limit < 1 {
+		params.Query.Limit = UserListSpec.DefaultLimit
+	}
+
+	users, next, err := s.fetchUsers(params)
 	if err != nil {
 		return nil, err
 	}
 
-	count, err := s.CountUsers(params.Filters)
+	count, err := s.CountUsers(params)
 	if err != nil {
 		return nil, err
 	}
 
-	totalPages := (count + int64(params.Limit) - 1) / int64(params.Limit)
-	currentPage := (params.Offset / params.Limit) + 1
+	response := &UserResponse{
+		Users:      users,
+		TotalCount: count,
+		NextCursor: next,
+	}
+	if !params.Query.HasCursor() {
+		limit := int64(params.Query.Limit)
+		response.TotalPages = (count + limit - 1) / limit
+		response.CurrentPage = params.Query.Offset/params.Query.Limit + 1
+	}
 
-	return &UserResponse{
-		Users:       users,
-		TotalCount:  count,
-		TotalPages:  totalPages,
-		CurrentPage: currentPage,
-	}, nil
+	return response, nil
 }
 
-func (s *UserService) fetchUsers(params UserFilters) ([]models.User, error) {
-	query := s.db.QB.From("users").
-		Select("users.*").
-		Limit(uint(params.Limit)).
-		Offset(uint(params.Offset))
+// filteredUsers selects the users matching the filters of a list request
+func (s *UserService) filteredUsers(params UserFilters) *goqu.SelectDataset {
+	query := s.db.QB.From("users")
+
+	if filters := params.Query.Where(); len(filters) > 0 {
+		query = query.Where(filters...)
+	}
+	if !params.IncludeDeleted {
+		query = query.Where(notDeleted)
+	}
+	if params.Search != "" {
+		// Substring matches use the trigram indexes; % also finds misspelled names
+		pattern := "%" + likeEscaper.Replace(params.Search) + "%"
+		query = query.Where(goqu.L(
+			"(users.name ILIKE ? OR users.email ILIKE ? OR users.nim_nip ILIKE ? OR users.name % ?)",
+			pattern, pattern, pattern, params.Search,
+		))
+	}
+
+	return query
+}
 
-	if len(params.Filters) > 0 {
-		query = query.Where(goqu.Ex(params.Filters))
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// searchRank orders search results by their best trigram similarity
+func searchRank(search string) exp.OrderedExpression {
+	return goqu.L(
+		"GREATEST(similarity(users.name, ?), similarity(users.email, ?), similarity(users.nim_nip, ?))",
+		search, search, search,
+	).Desc()
+}
+
+// fetchUsers returns a page of users and the cursor of the next one
+func (s *UserService) fetchUsers(params UserFilters) ([]models.BaseUser, string, error) {
+	query := s.filteredUsers(params).Select(
+		goqu.I("users.id"),
+		goqu.I("users.nim_nip"),
+		goqu.I("users.name"),
+		goqu.I("users.email"),
+		goqu.I("users.role"),
+		goqu.I("users.department_code"),
+		goqu.I("users.entry_year"),
+		goqu.I("users.status"),
+		goqu.I("users.address"),
+		goqu.I("users.photo_url"),
+		goqu.I("users.created_at"),
+		goqu.I("users.updated_at"),
+		goqu.I("users.deleted_at"),
+		goqu.I("users.purged_at"),
+	)
+
+	if params.rankSearch() {
+		query = query.
+			Order(searchRank(params.Search), goqu.I("users.id").Asc()).
+			Limit(uint(params.Query.Limit)).
+			Offset(uint(params.Query.Offset))
+	} else {
+		query = params.Query.Page(query)
 	}
 
 	sqlQuery, _, err := query.ToSQL()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	var users []models.User
+	var users []models.BaseUser
 	if err := s.db.Conn.Select(&users, sqlQuery); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return users, nil
+	if params.rankSearch() {
+		return users, "", nil
+	}
+
+	users, next := UserListSpec.Next(params.Query, users)
+	return users, next, nil
 }
 
 type UserDetails struct {
@@ -84,6 +210,12 @@ type UserDetails struct {
 }
 
 func (s *UserService) GetUserByID(userID int64) (*UserDetails, error) {
+	return s.cache.GetOrLoad(context.Background(), strconv.FormatInt(userID, 10), func() (*UserDetails, error) {
+		return s.loadUserByID(userID)
+	})
+}
+
+func (s *UserService) loadUserByID(userID int64) (*UserDetails, error) {
 	var user UserDetails
 	query := s.db.QB.From("users").
 		Select(
@@ -115,7 +247,7 @@ func (s *UserService) GetUserByID(userID int64) (*UserDetails, error) {
 			goqu.T("study_plan_details"),
 			goqu.On(goqu.Ex{"study_plans.id": goqu.I("study_plan_details.study_plan_id")}),
 		).
-		Where(goqu.Ex{"users.id": userID})
+		Where(goqu.Ex{"users.id": userID}, notDeleted)
 
 	sqlQuery, _, err := query.ToSQL()
 	if err != nil {
@@ -132,75 +264,293 @@ func (s *UserService) GetUserByID(userID int64) (*UserDetails, error) {
 	return &user, nil
 }
 
-func (s *UserService) CreateUser(user *models.User) error {
-	exists, err := s.CheckUserExists("email", user.Email)
+// CreateUser validates the input and creates the user. A password must
+// already be hashed; without one the user sets it through the reset flow.
+func (s *UserService) CreateUser(input CreateUserInput) (*UserDetails, error) {
+	if err := requireCreateFields(input).Err(); err != nil {
+		return nil, err
+	}
+
+	password := input.Password
+	if password == "" {
+		password = utils.UnusablePassword
+	}
+
+	status := strings.TrimSpace(input.Status)
+	if status == "" {
+		status = models.UserStatusActive
+	}
+	if err := validateInitialStatus(status); err != nil {
+		return nil, err
+	}
+
+	var nimNip *string
+	if strings.TrimSpace(input.NimNip) != "" {
+		nimNip = &input.NimNip
+	}
+
+	record, err := s.userRecord(UpdateUserInput{
+		NimNip:         nimNip,
+		Name:           &input.Name,
+		Email:          &input.Email,
+		Password:       &password,
+		Role:           &input.Role,
+		DepartmentCode: input.DepartmentCode,
+		EntryYear:      input.EntryYear,
+		Address:        input.Address,
+	}, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if exists {
-		return errors.New("user with this email already exists")
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
+	if nimNip == nil {
+		var departmentCode *string
+		if code, ok := record["department_code"].(string); ok {
+			departmentCode = &code
+		}
 
-	query := s.db.QB.Insert("users").Rows(user)
-	sqlQuery, args, err := query.ToSQL()
+		generated, err := NewNumberingService(s.db).Generate(tx, input.Role, departmentCode, input.EntryYear)
+		if err != nil {
+			if errors.Is(err, ErrNoNumberingRule) {
+				return nil, FieldErrors{"nim_nip": "is required, no numbering rule matches the role and department"}
+			}
+			return nil, err
+		}
+		record["nim_nip"] = generated
+	}
+
+	userID := utils.GenerateId()
+	now := time.Now()
+	record["id"] = userID
+	record["status"] = status
+	record["created_at"] = now
+	record["updated_at"] = now
+
+	sqlQuery, args, err := s.db.QB.Insert("users").Rows(record).ToSQL()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = s.db.Conn.Exec(sqlQuery, args...)
-	return err
+	if _, err := tx.Exec(sqlQuery, args...); err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, uniqueUserError(err)
+		}
+		return nil, err
+	}
+
+	sqlQuery, _, err = s.db.QB.Insert("user_status_history").
+		Rows(statusHistoryRecord(userID, nil, status, nil, now, nil)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return nil, err
+	}
+
+	if err := NewLecturerService(s.db).EnsureProfiles(tx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserByID(userID)
 }
 
-func (s *UserService) UpdateUser(userID string, updates map[string]interface{}) error {
-	if email, ok := updates["email"].(string); ok {
-		exists, err := s.CheckUserExists("email", email)
-		if err != nil {
+// UpdateUser validates the input and changes the fields it sets. A password
+// must already be hashed.
+func (s *UserService) UpdateUser(userID int64, input UpdateUserInput) error {
+	record, err := s.userRecord(input, userID)
+	if err != nil {
+		return err
+	}
+
+	record["updated_at"] = time.Now()
+
+	// A role change creates the lecturer profile in the same transaction
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = s.execUserUpdate(tx, s.db.QB.Update("users").
+		Set(record).
+		Where(goqu.Ex{"id": userID}, notDeleted))
+	if pgErrorCode(err) == "23505" {
+		return uniqueUserError(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if input.Role != nil {
+		if err := NewLecturerService(s.db).EnsureProfiles(tx, userID); err != nil {
 			return err
 		}
-		if exists {
-			return errors.New("email already in use")
-		}
 	}
 
-	updates["updated_at"] = time.Now()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
+	s.cache.Delete(context.Background(), strconv.FormatInt(userID, 10))
+	return nil
+}
+
+// uniqueUserError reports a unique violation on users as a field error, for
+// writes that raced past the validation
+func uniqueUserError(err error) error {
+	if pgConstraintName(err) == "users_nim_nip_key" {
+		return FieldErrors{"nim_nip": "is already in use"}
+	}
+	return FieldErrors{"email": "is already in use"}
+}
+
+// UpdateProfile changes the fields users may edit on their own account
+func (s *UserService) UpdateProfile(userID int64, input UpdateProfileInput) error {
+	return s.UpdateUser(userID, UpdateUserInput{
+		Name:    input.Name,
+		Address: input.Address,
+	})
+}
+
+// DeleteUser soft-deletes a user. The row, and every academic record
+// referencing it, is kept so the user can be restored.
+func (s *UserService) DeleteUser(userID int64) error {
+	now := time.Now()
 	query := s.db.QB.Update("users").
-		Set(updates).
-		Where(goqu.Ex{"id": userID})
+		Set(goqu.Record{"deleted_at": now, "updated_at": now}).
+		Where(goqu.Ex{"id": userID}, notDeleted)
 
-	sqlQuery, args, err := query.ToSQL()
-	if err != nil {
+	if err := s.execUserUpdate(s.db.Conn, query); err != nil {
 		return err
 	}
 
-	result, err := s.db.Conn.Exec(sqlQuery, args...)
+	s.cache.Delete(context.Background(), strconv.FormatInt(userID, 10))
+	return nil
+}
+
+// RestoreUser undoes a soft delete. Purged users cannot be restored, and the
+// photo removed on delete does not come back.
+func (s *UserService) RestoreUser(userID int64) error {
+	query := s.db.QB.Update("users").
+		Set(goqu.Record{"deleted_at": nil, "updated_at": time.Now()}).
+		Where(goqu.Ex{"id": userID, "deleted_at": goqu.Op{"neq": nil}, "purged_at": nil})
+
+	if err := s.execUserUpdate(s.db.Conn, query); err != nil {
+		return err
+	}
+
+	s.cache.Delete(context.Background(), strconv.FormatInt(userID, 10))
+	return nil
+}
+
+// PurgeUser anonymizes a deleted user. Personal data and login credentials are
+// removed while the row stays in place for the academic records referencing it.
+func (s *UserService) PurgeUser(userID int64) error {
+	var state struct {
+		ID        int64      `db:"id"`
+		NimNip    string     `db:"nim_nip"`
+		Email     string     `db:"email"`
+		DeletedAt *time.Time `db:"deleted_at"`
+		PurgedAt  *time.Time `db:"purged_at"`
+	}
+
+	sqlQuery, _, err := s.db.QB.From("users").
+		Select("id", "nim_nip", "email", "deleted_at", "purged_at").
+		Where(goqu.Ex{"id": userID}).
+		ToSQL()
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if err := s.db.Conn.Get(&state, sqlQuery); err != nil {
+		return err
+	}
+
+	if state.DeletedAt == nil {
+		return ErrUserNotDeleted
+	}
+	if state.PurgedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	placeholder := fmt.Sprintf("deleted-%d", state.ID)
+	statements := []exp.SQLExpression{
+		// The admission list holds the same NIM, name and email. Deleting the
+		// admission also removes the registration that used it.
+		s.db.QB.Delete("admissions").Where(goqu.Or(
+			goqu.C("id").In(s.db.QB.From("registrations").Select("admission_id").Where(goqu.Ex{"user_id": state.ID})),
+			goqu.And(
+				goqu.C("nim_nip").Eq(state.NimNip),
+				goqu.Func("LOWER", goqu.C("email")).Eq(normalizeEmail(state.Email)),
+			),
+		)),
+		s.db.QB.Update("users").
+			Set(goqu.Record{
+				"nim_nip":    placeholder,
+				"name":       "Deleted user",
+				"email":      placeholder + "@deleted.invalid",
+				"password":   utils.UnusablePassword,
+				"address":    nil,
+				"photo_url":  nil,
+				"purged_at":  now,
+				"updated_at": now,
+			}).
+			Where(goqu.Ex{"id": state.ID}),
+		s.db.QB.Delete("user_two_factor").Where(goqu.Ex{"user_id": state.ID}),
+		s.db.QB.Delete("user_recovery_codes").Where(goqu.Ex{"user_id": state.ID}),
+		s.db.QB.Delete("webauthn_credentials").Where(goqu.Ex{"user_id": state.ID}),
+		s.db.QB.Update("security_events").
+			Set(goqu.Record{"email": nil, "ip": nil, "user_agent": nil}).
+			Where(goqu.Ex{"user_id": state.ID}),
+	}
+
+	tx, err := s.db.Conn.Beginx()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	for _, statement := range statements {
+		sqlQuery, args, err := statement.ToSQL()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(sqlQuery, args...); err != nil {
+			return err
+		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.cache.Delete(context.Background(), strconv.FormatInt(userID, 10))
 	return nil
 }
 
-func (s *UserService) DeleteUser(userID string) error {
-	query := s.db.QB.Delete("users").Where(goqu.Ex{"id": userID})
+// execUserUpdate runs an update on a single user, returning sql.ErrNoRows
+// when no row matched
+func (s *UserService) execUserUpdate(exec sqlx.Execer, query *goqu.UpdateDataset) error {
 	sqlQuery, args, err := query.ToSQL()
 	if err != nil {
 		return err
 	}
 
-	result, err := s.db.Conn.Exec(sqlQuery, args...)
+	result, err := exec.Exec(sqlQuery, args...)
 	if err != nil {
 		return err
 	}
@@ -217,11 +567,8 @@ func (s *UserService) DeleteUser(userID string) error {
 	return nil
 }
 
-func (s *UserService) CountUsers(filters map[string]interface{}) (int64, error) {
-	query := s.db.QB.From("users").Select(goqu.COUNT("*"))
-	if len(filters) > 0 {
-		query = query.Where(goqu.Ex(filters))
-	}
+func (s *UserService) CountUsers(params UserFilters) (int64, error) {
+	query := s.filteredUsers(params).Select(goqu.COUNT("*"))
 
 	sqlQuery, _, err := query.ToSQL()
 	if err != nil {
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// UserExportColumns are the columns that can be exported, in their default
+// order. The password column is deliberately not exportable.
+var UserExportColumns = []string{
+	"id", "nim_nip", "name", "email", "role", "department_code", "entry_year",
+	"status", "address", "photo_url", "created_at", "updated_at", "deleted_at",
+}
+
+// Supported export formats
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// exportSheet is the worksheet XLSX exports are written to
+const exportSheet = "Sheet1"
+
+// ExportColumns resolves a comma separated column list, defaulting to every
+// exportable column
+func ExportColumns(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return UserExportColumns, nil
+	}
+
+	allowed := make(map[string]bool, len(UserExportColumns))
+	for _, column := range UserExportColumns {
+		allowed[column] = true
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, column := range strings.Split(list, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" || seen[column] {
+			continue
+		}
+		if !allowed[column] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown export column: "+column)
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// ExportUsers writes the users matching the filters as CSV or XLSX. Rows are
+// read from the database one at a time; XLSX rows are buffered by the
+// spreadsheet library on disk rather than in memory. Stored photos are
+// exported as the URL photos resolves them to.
+func (s *UserService) ExportUsers(ctx context.Context, w io.Writer, format string, params UserFilters, columns []string, photos *PhotoService) error {
+	switch format {
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+
+		err := s.eachExportRow(ctx, params, columns, photos, func(values []string) error {
+			for i, value := range values {
+				values[i] = escapeFormula(value)
+			}
+			return writer.Write(values)
+		})
+		if err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+
+	case ExportFormatXLSX:
+		file := excelize.NewFile()
+		defer file.Close()
+
+		stream, err := file.NewStreamWriter(exportSheet)
+		if err != nil {
+			return err
+		}
+
+		row := 1
+		writeRow := func(values []string) error {
+			cells := make([]interface{}, len(values))
+			for i, value := range values {
+				cells[i] = value
+			}
+
+			cell, err := excelize.CoordinatesToCellName(1, row)
+			if err != nil {
+				return err
+			}
+			row++
+
+			return stream.SetRow(cell, cells)
+		}
+
+		if err := writeRow(columns); err != nil {
+			return err
+		}
+		// Cells are written as strings, so XLSX needs no formula escaping
+		if err := s.eachExportRow(ctx, params, columns, photos, writeRow); err != nil {
+			return err
+		}
+		if err := stream.Flush(); err != nil {
+			return err
+		}
+
+		buffered := bufio.NewWriter(w)
+		if err := file.Write(buffered); err != nil {
+			return err
+		}
+		return buffered.Flush()
+
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be csv or xlsx")
+	}
+}
+
+// eachExportRow streams the selected columns of every matching user, in the
+// order of the list sort, formatted as strings
+func (s *UserService) eachExportRow(ctx context.Context, params UserFilters, columns []string, photos *PhotoService, fn func([]string) error) error {
+	selected := make([]interface{}, len(columns))
+	for i, column := range columns {
+		selected[i] = goqu.I("users." + column)
+	}
+
+	sqlQuery, _, err := s.filteredUsers(params).
+		Select(selected...).
+		Order(params.Query.Order()...).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Conn.Queryx(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = exportValue(value)
+
+			if columns[i] == "photo_url" && record[i] != "" {
+				if record[i], err = photos.URL(ctx, record[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func exportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeFormula keeps spreadsheet applications from evaluating a CSV cell as
+// a formula, e.g. a name of =HYPERLINK(...), by prefixing it with a quote
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
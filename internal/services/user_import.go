@@ -0,0 +1,444 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/xuri/excelize/v2"
+)
+
+// userImportBatchSize bounds the number of rows per INSERT statement
+const userImportBatchSize = 500
+
+// userImportColumns are the columns an import file may have; the first four are required
+var userImportColumns = []string{"nim_nip", "name", "email", "role", "department_code", "entry_year", "address"}
+
+// UserImportService creates users in bulk from CSV or XLSX files
+type UserImportService struct {
+	db        *database.ECampusDB
+	passwords *PasswordService
+}
+
+// UserImportRow is one data row of an import file. Row is the line number in
+// the file, counting the header as line 1.
+type UserImportRow struct {
+	Row            int
+	NimNip         string
+	Name           string
+	Email          string
+	Role           string
+	DepartmentCode string
+	EntryYear      string
+	Address        string
+}
+
+// UserImportResult reports the outcome of a single row
+type UserImportResult struct {
+	Row      int      `json:"row"`
+	NimNip   string   `json:"nim_nip"`
+	Email    string   `json:"email"`
+	UserID   int64    `json:"user_id,omitempty"`
+	Password string   `json:"password,omitempty"` // Generated password, only returned once by a real run
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type UserImportReport struct {
+	DryRun  bool               `json:"dry_run"`
+	Total   int                `json:"total"`
+	Invalid int                `json:"invalid"`
+	Created int                `json:"created"`
+	Rows    []UserImportResult `json:"rows"`
+}
+
+func NewUserImportService(db *database.ECampusDB, cfg config.Config) *UserImportService {
+	return &UserImportService{
+		db:        db,
+		passwords: NewPasswordService(cfg),
+	}
+}
+
+// ParseUserImport reads the rows of a CSV or XLSX file, chosen by extension.
+// The first row is the header and columns may appear in any order.
+func ParseUserImport(filename string, r io.Reader) ([]UserImportRow, error) {
+	var records [][]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err = reader.ReadAll()
+	case ".xlsx":
+		records, err = readXLSX(r)
+	default:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "File must be a .csv or .xlsx file")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Failed to read file: "+err.Error())
+	}
+
+	if len(records) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "File is empty")
+	}
+
+	index := make(map[string]int)
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		index[strings.ReplaceAll(column, " ", "_")] = i
+	}
+
+	for _, column := range userImportColumns[:4] {
+		if _, ok := index[column]; !ok {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Missing column: "+column)
+		}
+	}
+
+	rows := make([]UserImportRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		value := func(column string) string {
+			if j, ok := index[column]; ok && j < len(record) {
+				return strings.TrimSpace(record[j])
+			}
+			return ""
+		}
+
+		row := UserImportRow{
+			Row:            i + 2,
+			NimNip:         value("nim_nip"),
+			Name:           value("name"),
+			Email:          normalizeEmail(value("email")),
+			Role:           value("role"),
+			DepartmentCode: value("department_code"),
+			EntryYear:      value("entry_year"),
+			Address:        value("address"),
+		}
+
+		// Spreadsheets often end with formatted but empty rows
+		if row == (UserImportRow{Row: row.Row}) {
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+
+	return file.GetRows(sheets[0])
+}
+
+// Import validates every row and, unless dryRun is set or a row is invalid,
+// creates all users in a single transaction. Each user gets a generated
+// password that is returned in the report.
+func (s *UserImportService) Import(rows []UserImportRow, dryRun bool) (*UserImportReport, error) {
+	if len(rows) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "File has no data rows")
+	}
+
+	report, err := s.validate(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	report.DryRun = dryRun
+	if dryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	passwords, hashes, err := s.generatePasswords(len(rows))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to generate passwords")
+	}
+
+	now := time.Now()
+	records := make([]interface{}, len(rows))
+	history := make([]interface{}, len(rows))
+	for i, row := range rows {
+		id := utils.GenerateId()
+
+		record := goqu.Record{
+			"id":              id,
+			"nim_nip":         row.NimNip,
+			"name":            row.Name,
+			"email":           row.Email,
+			"password":        hashes[i],
+			"role":            row.Role,
+			"department_code": nil,
+			"entry_year":      nil,
+			"address":         nil,
+			"status":          models.UserStatusActive,
+			"created_at":      now,
+			"updated_at":      now,
+		}
+		if row.DepartmentCode != "" {
+			record["department_code"] = row.DepartmentCode
+		}
+		if row.EntryYear != "" {
+			record["entry_year"], _ = strconv.Atoi(row.EntryYear)
+		}
+		if row.Address != "" {
+			record["address"] = row.Address
+		}
+		records[i] = record
+		history[i] = statusHistoryRecord(id, nil, models.UserStatusActive, nil, now, nil)
+
+		report.Rows[i].UserID = id
+		report.Rows[i].Password = passwords[i]
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to import users")
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(records); start += userImportBatchSize {
+		end := min(start+userImportBatchSize, len(records))
+
+		sqlQuery, _, err := s.db.QB.Insert("users").Rows(records[start:end]...).ToSQL()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(sqlQuery); err != nil {
+			// Another request created one of the users after validation
+			if pgErrorCode(err) == "23505" {
+				return nil, fiber.NewError(fiber.StatusConflict, "A user in the file was created during the import, run it again")
+			}
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to import users")
+		}
+
+		sqlQuery, _, err = s.db.QB.Insert("user_status_history").Rows(history[start:end]...).ToSQL()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(sqlQuery); err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to import users")
+		}
+
+		ids := make([]int64, 0, end-start)
+		for _, row := range report.Rows[start:end] {
+			ids = append(ids, row.UserID)
+		}
+		if err := NewLecturerService(s.db).EnsureProfiles(tx, ids...); err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to import users")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to import users")
+	}
+
+	report.Created = len(rows)
+	return report, nil
+}
+
+// validate checks every row against the database and the rest of the file
+func (s *UserImportService) validate(rows []UserImportRow) (*UserImportReport, error) {
+	roles, err := s.existing("roles", "name", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	departments, err := s.existing("departments", "code", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, 0, len(rows))
+	nimNips := make([]string, 0, len(rows))
+	for _, row := range rows {
+		emails = append(emails, row.Email)
+		nimNips = append(nimNips, row.NimNip)
+	}
+
+	// Soft-deleted users still hold their email and NIM/NIP
+	takenEmails, err := s.existing("users", "email", emails)
+	if err != nil {
+		return nil, err
+	}
+
+	takenNimNips, err := s.existing("users", "nim_nip", nimNips)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UserImportReport{Total: len(rows), Rows: make([]UserImportResult, len(rows))}
+	seenEmails := make(map[string]int)
+	seenNimNips := make(map[string]int)
+
+	for i, row := range rows {
+		var rowErrors []string
+		fail := func(format string, args ...interface{}) {
+			rowErrors = append(rowErrors, fmt.Sprintf(format, args...))
+		}
+
+		if row.NimNip == "" {
+			fail("nim_nip is required")
+		} else if first, ok := seenNimNips[row.NimNip]; ok {
+			fail("nim_nip %s is duplicated on row %d", row.NimNip, first)
+		} else if takenNimNips[row.NimNip] {
+			fail("nim_nip %s is already in use", row.NimNip)
+		}
+
+		if row.Name == "" {
+			fail("name is required")
+		}
+
+		if row.Email == "" {
+			fail("email is required")
+		} else if !validEmail(row.Email) {
+			fail("email %s is not a valid address", row.Email)
+		} else if first, ok := seenEmails[row.Email]; ok {
+			fail("email %s is duplicated on row %d", row.Email, first)
+		} else if takenEmails[row.Email] {
+			fail("email %s is already in use", row.Email)
+		}
+
+		if row.Role == "" {
+			fail("role is required")
+		} else if !roles[row.Role] {
+			fail("role %s does not exist", row.Role)
+		}
+
+		if row.DepartmentCode != "" && !departments[row.DepartmentCode] {
+			fail("department_code %s does not exist", row.DepartmentCode)
+		}
+
+		if row.EntryYear != "" {
+			if year, err := strconv.Atoi(row.EntryYear); err != nil || year < 1900 || year > 9999 {
+				fail("entry_year %s is not a valid year", row.EntryYear)
+			}
+		}
+
+		if _, ok := seenNimNips[row.NimNip]; !ok && row.NimNip != "" {
+			seenNimNips[row.NimNip] = row.Row
+		}
+		if _, ok := seenEmails[row.Email]; !ok && row.Email != "" {
+			seenEmails[row.Email] = row.Row
+		}
+
+		if len(rowErrors) > 0 {
+			report.Invalid++
+		}
+
+		report.Rows[i] = UserImportResult{
+			Row:    row.Row,
+			NimNip: row.NimNip,
+			Email:  row.Email,
+			Errors: rowErrors,
+		}
+	}
+
+	return report, nil
+}
+
+// existing returns the values of a column present in a table. With values set
+// only those values are looked up; emails are compared case-insensitively.
+func (s *UserImportService) existing(table, column string, values []string) (map[string]bool, error) {
+	var expression goqu.Expression = goqu.C(column)
+	if column == "email" {
+		expression = goqu.Func("LOWER", goqu.C(column))
+	}
+
+	query := s.db.QB.From(table).Select(goqu.L("?", expression).As("value"))
+	if values != nil {
+		if len(values) == 0 {
+			return map[string]bool{}, nil
+		}
+		query = query.Where(goqu.L("?", expression).In(values))
+	}
+
+	sqlQuery, _, err := query.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	if err := s.db.Conn.Select(&found, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to validate rows")
+	}
+
+	set := make(map[string]bool, len(found))
+	for _, value := range found {
+		set[value] = true
+	}
+
+	return set, nil
+}
+
+// generatePasswords creates n random passwords and their argon2 hashes.
+// Hashing is spread over the available CPUs since it dominates large imports.
+func (s *UserImportService) generatePasswords(n int) ([]string, []string, error) {
+	passwords := make([]string, n)
+	hashes := make([]string, n)
+	params := s.passwords.params()
+
+	for i := range passwords {
+		password, err := utils.GenerateRandomToken(12)
+		if err != nil {
+			return nil, nil, err
+		}
+		passwords[i] = password
+	}
+
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	jobs := make(chan int)
+
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash, err := utils.HashData(passwords[i], params)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				hashes[i] = hash
+			}
+		}()
+	}
+
+	for i := range passwords {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+
+	return passwords, hashes, nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+)
+
+// FieldErrors maps the JSON fields of a request body to what is wrong with
+// them. The error handler turns it into a 422 response.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	return "validation failed"
+}
+
+// Add records a problem with a field, keeping the first one reported
+func (e FieldErrors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Err returns the errors as an error, or nil when there are none
+func (e FieldErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// CreateUserInput is an account created by an admin
+type CreateUserInput struct {
+	NimNip         string  `json:"nim_nip"` // Optional; generated by the numbering rules when empty
+	Name           string  `json:"name"`
+	Email          string  `json:"email"`
+	Password       string  `json:"password"` // Optional; without one the user sets it through the reset flow
+	Role           string  `json:"role"`
+	DepartmentCode *string `json:"department_code"`
+	EntryYear      *int    `json:"entry_year"`
+	Status         string  `json:"status"` // Initial status, defaults to active
+	Address        *string `json:"address"`
+}
+
+// UpdateUserInput changes the fields that are set and keeps the others. An
+// empty department_code or address clears it. Status is rejected, it is
+// changed through ChangeStatus.
+type UpdateUserInput struct {
+	NimNip         *string `json:"nim_nip"`
+	Name           *string `json:"name"`
+	Email          *string `json:"email"`
+	Password       *string `json:"password"`
+	Role           *string `json:"role"`
+	DepartmentCode *string `json:"department_code"`
+	EntryYear      *int    `json:"entry_year"`
+	Status         *string `json:"status"`
+	Address        *string `json:"address"`
+}
+
+// UpdateProfileInput holds the fields users may change on their own account
+type UpdateProfileInput struct {
+	Name    *string `json:"name"`
+	Address *string `json:"address"`
+}
+
+// Column limits of the users table
+const (
+	maxNimNipLength = 100
+	maxNameLength   = 255
+	maxEmailLength  = 255
+)
+
+// userRecord validates an update and turns it into the columns to set. userID
+// is the user being updated, or 0 for a new user, and is skipped by the
+// uniqueness checks.
+func (s *UserService) userRecord(input UpdateUserInput, userID int64) (goqu.Record, error) {
+	fields := FieldErrors{}
+	record := goqu.Record{}
+
+	if input.NimNip != nil {
+		nimNip := strings.TrimSpace(*input.NimNip)
+		switch {
+		case nimNip == "":
+			fields.Add("nim_nip", "must not be empty")
+		case len(nimNip) > maxNimNipLength:
+			fields.Add("nim_nip", "must be at most 100 characters long")
+		default:
+			taken, err := s.taken(goqu.C("nim_nip"), nimNip, userID)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				fields.Add("nim_nip", "is already in use")
+			}
+			record["nim_nip"] = nimNip
+		}
+	}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		switch {
+		case name == "":
+			fields.Add("name", "must not be empty")
+		case utf8.RuneCountInString(name) > maxNameLength:
+			fields.Add("name", "must be at most 255 characters long")
+		default:
+			record["name"] = name
+		}
+	}
+
+	if input.Email != nil {
+		email := normalizeEmail(*input.Email)
+		switch {
+		case email == "":
+			fields.Add("email", "must not be empty")
+		case len(email) > maxEmailLength:
+			fields.Add("email", "must be at most 255 characters long")
+		case !validEmail(email):
+			fields.Add("email", "must be a valid email address")
+		default:
+			// Soft-deleted users still hold their email
+			taken, err := s.taken(goqu.Func("LOWER", goqu.C("email")), email, userID)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				fields.Add("email", "is already in use")
+			}
+			record["email"] = email
+		}
+	}
+
+	if input.Password != nil {
+		if !utils.IsPasswordHash(*input.Password) {
+			return nil, ErrPasswordNotHashed
+		}
+		record["password"] = *input.Password
+	}
+
+	if input.Role != nil {
+		exists, err := s.rowExists("roles", goqu.Ex{"name": *input.Role})
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			fields.Add("role", "does not exist")
+		}
+		record["role"] = *input.Role
+	}
+
+	if input.DepartmentCode != nil {
+		code := strings.TrimSpace(*input.DepartmentCode)
+		if code == "" {
+			record["department_code"] = nil
+		} else {
+			exists, err := s.rowExists("departments", goqu.Ex{"code": code})
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				fields.Add("department_code", "does not exist")
+			}
+			record["department_code"] = code
+		}
+	}
+
+	if input.EntryYear != nil {
+		if *input.EntryYear < 1900 || *input.EntryYear > 9999 {
+			fields.Add("entry_year", "must be a valid year")
+		}
+		record["entry_year"] = *input.EntryYear
+	}
+
+	if input.Status != nil {
+		fields.Add("status", "must be changed through the status endpoint")
+	}
+
+	if input.Address != nil {
+		if address := strings.TrimSpace(*input.Address); address == "" {
+			record["address"] = nil
+		} else {
+			record["address"] = address
+		}
+	}
+
+	if err := fields.Err(); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// requireCreateFields reports the fields a new user cannot go without
+func requireCreateFields(input CreateUserInput) FieldErrors {
+	fields := FieldErrors{}
+	if strings.TrimSpace(input.Name) == "" {
+		fields.Add("name", "is required")
+	}
+	if strings.TrimSpace(input.Email) == "" {
+		fields.Add("email", "is required")
+	}
+	if input.Role == "" {
+		fields.Add("role", "is required")
+	}
+	return fields
+}
+
+// taken reports whether another user already has a value
+func (s *UserService) taken(column goqu.Expression, value string, userID int64) (bool, error) {
+	return s.rowExists("users", goqu.L("?", column).Eq(value), goqu.C("id").Neq(userID))
+}
+
+func (s *UserService) rowExists(table string, conditions ...goqu.Expression) (bool, error) {
+	sqlQuery, _, err := s.db.QB.Select(goqu.L("EXISTS ?", s.db.QB.From(table).Where(conditions...))).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	if err := s.db.Conn.Get(&exists, sqlQuery); err != nil {
+		return false, fiber.NewError(fiber.StatusInternalServerError, "Failed to validate user")
+	}
+
+	return exists, nil
+}
+
+// validEmail is a loose check for an address of the form local@domain
+func validEmail(email string) bool {
+	at := strings.IndexByte(email, '@')
+	return at > 0 && at < len(email)-1 && !strings.ContainsAny(email, " \t\r\n")
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+)
+
+// userStatusTransitions lists the status changes ChangeStatus allows and
+// whether each one needs a reason. Graduated, dropped out and transferred are
+// final; pending registrations are decided by RegistrationService.
+var userStatusTransitions = map[string]map[string]bool{
+	models.UserStatusActive: {
+		models.UserStatusOnLeave:     true,
+		models.UserStatusSuspended:   true,
+		models.UserStatusGraduated:   false,
+		models.UserStatusDroppedOut:  true,
+		models.UserStatusTransferred: true,
+	},
+	models.UserStatusOnLeave: {
+		models.UserStatusActive:     false,
+		models.UserStatusDroppedOut: true,
+	},
+	models.UserStatusSuspended: {
+		models.UserStatusActive:     true,
+		models.UserStatusDroppedOut: true,
+	},
+}
+
+// userStatuses are the statuses a user can be created with
+var userStatuses = map[string]bool{
+	models.UserStatusActive:              true,
+	models.UserStatusPendingVerification: true,
+	models.UserStatusOnLeave:             true,
+	models.UserStatusSuspended:           true,
+	models.UserStatusGraduated:           true,
+	models.UserStatusDroppedOut:          true,
+	models.UserStatusTransferred:         true,
+}
+
+// StatusChangeInput moves a user to another status. EffectiveDate is a
+// YYYY-MM-DD date and defaults to today.
+type StatusChangeInput struct {
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	EffectiveDate string `json:"effective_date"`
+}
+
+// statusHistoryRecord is a user_status_history row. Every write of
+// users.status inserts one in the same transaction.
+func statusHistoryRecord(userID int64, from *string, to string, reason *string, effective time.Time, actorID *int64) goqu.Record {
+	return goqu.Record{
+		"user_id":        userID,
+		"from_status":    from,
+		"to_status":      to,
+		"reason":         reason,
+		"effective_date": effective.Format(time.DateOnly),
+		"actor_id":       actorID,
+		"created_at":     time.Now(),
+	}
+}
+
+// ChangeStatus applies an allowed status transition and records it in the
+// status history. actorID is nil for API keys.
+func (s *UserService) ChangeStatus(userID int64, input StatusChangeInput, actorID *int64) (*models.UserStatusChange, error) {
+	fields := FieldErrors{}
+
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Status == "" {
+		fields.Add("status", "is required")
+	}
+
+	year, month, day := time.Now().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	effective := today
+	if input.EffectiveDate != "" {
+		date, err := time.Parse(time.DateOnly, input.EffectiveDate)
+		switch {
+		case err != nil:
+			fields.Add("effective_date", "must be a date formatted as YYYY-MM-DD")
+		case date.After(today):
+			fields.Add("effective_date", "must not be in the future")
+		default:
+			effective = date
+		}
+	}
+
+	if err := fields.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent changes cannot both start from the same status
+	sqlQuery, _, err := s.db.QB.From("users").
+		Select("status").
+		Where(goqu.Ex{"id": userID}, notDeleted).
+		ForUpdate(exp.Wait).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var current string
+	if err := tx.Get(&current, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	reasonRequired, allowed := userStatusTransitions[current][input.Status]
+	if !allowed {
+		return nil, FieldErrors{"status": fmt.Sprintf("cannot change from %s to %s", current, input.Status)}
+	}
+	if reasonRequired && input.Reason == "" {
+		return nil, FieldErrors{"reason": "is required when changing to " + input.Status}
+	}
+
+	// History is ordered by effective date, so a change cannot predate the last one
+	sqlQuery, _, err = s.db.QB.From("user_status_history").
+		Select(goqu.MAX("effective_date")).
+		Where(goqu.Ex{"user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest sql.NullTime
+	if err := tx.Get(&latest, sqlQuery); err != nil {
+		return nil, err
+	}
+	if latest.Valid && effective.Before(latest.Time) {
+		return nil, FieldErrors{"effective_date": "must not be before the previous status change on " + latest.Time.Format(time.DateOnly)}
+	}
+
+	var reason *string
+	if input.Reason != "" {
+		reason = &input.Reason
+	}
+
+	sqlQuery, _, err = s.db.QB.Update("users").
+		Set(goqu.Record{"status": input.Status, "updated_at": time.Now()}).
+		Where(goqu.Ex{"id": userID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(sqlQuery); err != nil {
+		return nil, err
+	}
+
+	sqlQuery, _, err = s.db.QB.Insert("user_status_history").
+		Rows(statusHistoryRecord(userID, &current, input.Status, reason, effective, actorID)).
+		Returning("*").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var change models.UserStatusChange
+	if err := tx.Get(&change, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.cache.Delete(context.Background(), strconv.FormatInt(userID, 10))
+	return &change, nil
+}
+
+// GetAcademicYear returns an academic year period by id
+func (s *UserService) GetAcademicYear(academicYearID int64) (models.AcademicYear, error) {
+	var academicYear models.AcademicYear
+
+	sqlQuery, _, err := s.db.QB.From("academic_years").
+		Select("id", "year", "semester", "is_active", "start_date", "end_date", "created_at", "updated_at").
+		Where(goqu.Ex{"id": academicYearID}).
+		ToSQL()
+	if err != nil {
+		return academicYear, err
+	}
+
+	if err := s.db.Conn.Get(&academicYear, sqlQuery); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return academicYear, fiber.NewError(fiber.StatusNotFound, "Academic year not found")
+		}
+		return academicYear, err
+	}
+
+	return academicYear, nil
+}
+
+// GetStatusHistory returns the status changes of a user, oldest first
+func (s *UserService) GetStatusHistory(userID int64) ([]models.UserStatusChange, error) {
+	sqlQuery, _, err := s.db.QB.From("user_status_history").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("effective_date").Asc(), goqu.I("id").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	history := []models.UserStatusChange{}
+	if err := s.db.Conn.Select(&history, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// WasActiveDuring reports whether a user was active on any day of an
+// academic year period, between its start_date and end_date
+func (s *UserService) WasActiveDuring(userID int64, academicYear models.AcademicYear) (bool, error) {
+	start, end := academicYear.StartDate, academicYear.EndDate
+
+	// Each entry holds until the next one takes effect
+	periods := s.db.QB.From("user_status_history").
+		Select(
+			goqu.C("to_status"),
+			goqu.C("effective_date").As("starts"),
+			goqu.L("LEAD(effective_date) OVER (ORDER BY effective_date, id)").As("ends"),
+		).
+		Where(goqu.Ex{"user_id": userID})
+
+	sqlQuery, _, err := s.db.QB.Select(goqu.L("EXISTS ?", s.db.QB.From(periods.As("periods")).Where(
+		goqu.C("to_status").Eq(models.UserStatusActive),
+		goqu.C("starts").Lte(end.Format(time.DateOnly)),
+		goqu.Or(goqu.C("ends").IsNull(), goqu.C("ends").Gt(start.Format(time.DateOnly))),
+	))).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	var active bool
+	if err := s.db.Conn.Get(&active, sqlQuery); err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+// validateInitialStatus checks the status a user is created with
+func validateInitialStatus(status string) error {
+	if !userStatuses[status] {
+		return FieldErrors{"status": "is not a valid status"}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rafaalrazzak/e-campus-be/internal/constants"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/internal/utils"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/database"
+	"github.com/rafaalrazzak/e-campus-be/pkg/services/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// WebAuthnService runs the WebAuthn registration and assertion ceremonies.
+// Ceremony state is kept in Redis between the begin and finish requests.
+type WebAuthnService struct {
+	db          *database.ECampusDB
+	redisClient *redis.ECampusRedisDB
+	config      config.WebAuthn
+	authService *AuthService
+}
+
+// WebAuthnCeremony is returned by the begin steps. The token identifies the
+// ceremony and has to be sent back with the authenticator response.
+type WebAuthnCeremony struct {
+	CeremonyToken string      `json:"ceremony_token"`
+	Options       interface{} `json:"options"`
+}
+
+type WebAuthnLoginInput struct {
+	Email string `json:"email"` // Optional; without it only discoverable credentials (passkeys) can be used
+}
+
+// WebAuthnFinishInput carries the authenticator response as produced by
+// navigator.credentials.create() or get()
+type WebAuthnFinishInput struct {
+	CeremonyToken string          `json:"ceremony_token"`
+	Name          string          `json:"name"` // Label for a new credential
+	Credential    json.RawMessage `json:"credential"`
+}
+
+// webAuthnUser adapts a user and its credentials to webauthn.User
+type webAuthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.user.ID, 10))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func NewWebAuthnService(db *database.ECampusDB, redisClient *redis.ECampusRedisDB, cfg config.Config, authService *AuthService) *WebAuthnService {
+	return &WebAuthnService{
+		db:          db,
+		redisClient: redisClient,
+		config:      cfg.WebAuthn,
+		authService: authService,
+	}
+}
+
+// BeginRegistration starts adding an authenticator to the user's account
+func (s *WebAuthnService) BeginRegistration(userID int64) (*WebAuthnCeremony, error) {
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := relyingParty.BeginRegistration(user, registrationOptions(user)...)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start registration")
+	}
+
+	return s.storeCeremony(creation, session)
+}
+
+// FinishRegistration verifies the authenticator response and stores the credential
+func (s *WebAuthnService) FinishRegistration(userID int64, input WebAuthnFinishInput) (*models.WebAuthnCredential, error) {
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Name must be between 1 and 100 characters")
+	}
+
+	session, err := s.consumeCeremony(input.CeremonyToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ceremony has to be finished by the user who started it
+	if string(session.UserID) != string(user.WebAuthnID()) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired ceremony")
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid credential")
+	}
+
+	credential, err := relyingParty.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Credential could not be verified")
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store credential")
+	}
+
+	stored := models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Credential:   data,
+		CreatedAt:    time.Now(),
+	}
+
+	sqlQuery, _, err := s.db.QB.Insert("webauthn_credentials").Rows(stored).Returning("id").ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Conn.Get(&stored.ID, sqlQuery); err != nil {
+		if pgErrorCode(err) == "23505" {
+			return nil, fiber.NewError(fiber.StatusConflict, "Credential is already registered")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to store credential")
+	}
+
+	return &stored, nil
+}
+
+// BeginLogin starts an assertion. With an email the user's credentials are
+// offered; unknown emails fall back to a discoverable login so the response
+// does not reveal which accounts exist.
+func (s *WebAuthnService) BeginLogin(input WebAuthnLoginInput) (*WebAuthnCeremony, error) {
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Email != "" {
+		dbUser, err := s.authService.getUserFromDB(input.Email)
+		if err == nil {
+			user, err := s.loadUser(dbUser.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(user.credentials) > 0 {
+				assertion, session, err := relyingParty.BeginLogin(user, loginOptions...)
+				if err != nil {
+					return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start login")
+				}
+				return s.storeCeremony(assertion, session)
+			}
+		}
+	}
+
+	assertion, session, err := relyingParty.BeginDiscoverableLogin(loginOptions...)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start login")
+	}
+
+	return s.storeCeremony(assertion, session)
+}
+
+// FinishLogin verifies the assertion and creates a standard session. User
+// verification is required, so the assertion proves both possession of the
+// authenticator and the PIN or biometric unlocking it and already satisfies
+// the roles that make two-factor authentication mandatory.
+func (s *WebAuthnService) FinishLogin(input WebAuthnFinishInput, client ClientInfo) (*AuthTokens, error) {
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.consumeCeremony(input.CeremonyToken)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid credential")
+	}
+
+	user, credential, err := validateAssertion(relyingParty, *session, parsed, s.loadUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.touchCredential(credential); err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.checkLoginStatus(user.user); err != nil {
+		return nil, err
+	}
+
+	return s.authService.createSession(user.user, client)
+}
+
+// registrationOptions excludes the user's existing authenticators and
+// requires user verification, since a passkey replaces both the password and
+// the second factor
+func registrationOptions(user *webAuthnUser) []webauthn.RegistrationOption {
+	exclusions := make([]protocol.CredentialDescriptor, len(user.credentials))
+	for i, credential := range user.credentials {
+		exclusions[i] = credential.Descriptor()
+	}
+
+	return []webauthn.RegistrationOption{
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationRequired,
+		}),
+	}
+}
+
+// loginOptions requires user verification on every assertion, which also
+// covers credentials registered before registration required it
+var loginOptions = []webauthn.LoginOption{
+	webauthn.WithUserVerification(protocol.VerificationRequired),
+}
+
+// validateAssertion checks an assertion against the ceremony it answers and
+// returns the user it authenticates. Discoverable logins find the user from
+// the user handle through loadUser.
+func validateAssertion(relyingParty *webauthn.WebAuthn, session webauthn.SessionData, parsed *protocol.ParsedCredentialAssertionData, loadUser func(userID int64) (*webAuthnUser, error)) (*webAuthnUser, *webauthn.Credential, error) {
+	invalid := fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+
+	var user *webAuthnUser
+	var credential *webauthn.Credential
+	if len(session.UserID) > 0 {
+		userID, err := strconv.ParseInt(string(session.UserID), 10, 64)
+		if err != nil {
+			return nil, nil, invalid
+		}
+
+		if user, err = loadUser(userID); err != nil {
+			return nil, nil, invalid
+		}
+
+		if credential, err = relyingParty.ValidateLogin(user, session, parsed); err != nil {
+			return nil, nil, invalid
+		}
+	} else {
+		var err error
+		credential, err = relyingParty.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			userID, err := strconv.ParseInt(string(userHandle), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			user, err = loadUser(userID)
+			return user, err
+		}, session, parsed)
+		if err != nil {
+			return nil, nil, invalid
+		}
+	}
+
+	// A counter that went backwards means the key material was copied
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "Authenticator may be cloned, use another credential")
+	}
+
+	return user, credential, nil
+}
+
+// GetCredentials lists the authenticators registered by a user
+func (s *WebAuthnService) GetCredentials(userID int64) ([]models.WebAuthnCredential, error) {
+	sqlQuery, _, err := s.db.QB.From("webauthn_credentials").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("created_at").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []models.WebAuthnCredential{}
+	if err := s.db.Conn.Select(&credentials, sqlQuery); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch credentials")
+	}
+
+	return credentials, nil
+}
+
+func (s *WebAuthnService) DeleteCredential(userID, credentialID int64) error {
+	sqlQuery, _, err := s.db.QB.Delete("webauthn_credentials").
+		Where(goqu.Ex{"id": credentialID, "user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Conn.Exec(sqlQuery)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete credential")
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete credential")
+	} else if rowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Credential not found")
+	}
+
+	return nil
+}
+
+func (s *WebAuthnService) relyingParty() (*webauthn.WebAuthn, error) {
+	if s.config.RPID == "" {
+		return nil, fiber.NewError(fiber.StatusNotFound, "WebAuthn is not configured")
+	}
+
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          s.config.RPID,
+		RPDisplayName: s.config.RPDisplayName,
+		RPOrigins:     s.config.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: constants.App.WebAuthnCeremonyExpiration},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: constants.App.WebAuthnCeremonyExpiration},
+		},
+	})
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "WebAuthn is misconfigured")
+	}
+
+	return relyingParty, nil
+}
+
+// loadUser returns the user together with all of its registered credentials
+func (s *WebAuthnService) loadUser(userID int64) (*webAuthnUser, error) {
+	dbUser, err := s.authService.getUserByIDFromDB(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load user")
+	}
+
+	stored, err := s.GetCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, row := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(row.Credential, &credential); err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load credentials")
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return &webAuthnUser{user: dbUser, credentials: credentials}, nil
+}
+
+// touchCredential stores the new signature counter after a login
+func (s *WebAuthnService) touchCredential(credential *webauthn.Credential) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update credential")
+	}
+
+	sqlQuery, _, err := s.db.QB.Update("webauthn_credentials").
+		Set(goqu.Record{"credential": data, "last_used_at": time.Now()}).
+		Where(goqu.Ex{"credential_id": credential.ID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Conn.Exec(sqlQuery); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update credential")
+	}
+
+	return nil
+}
+
+func (s *WebAuthnService) storeCeremony(options interface{}, session *webauthn.SessionData) (*WebAuthnCeremony, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start ceremony")
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start ceremony")
+	}
+
+	redisKey := fmt.Sprintf(constants.Redis.WebAuthnCeremonyKey, utils.HashToken(token))
+	if err := s.redisClient.Client.Set(context.Background(), redisKey, data, constants.App.WebAuthnCeremonyExpiration).Err(); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to start ceremony")
+	}
+
+	return &WebAuthnCeremony{CeremonyToken: token, Options: options}, nil
+}
+
+// consumeCeremony loads the ceremony state; every ceremony can be finished once
+func (s *WebAuthnService) consumeCeremony(token string) (*webauthn.SessionData, error) {
+	if token == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Ceremony token is required")
+	}
+
+	redisKey := fmt.Sprintf(constants.Redis.WebAuthnCeremonyKey, utils.HashToken(token))
+	data, err := s.redisClient.Client.GetDel(context.Background(), redisKey).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired ceremony")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to load ceremony")
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid or expired ceremony")
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/rafaalrazzak/e-campus-be/internal/domain/models"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+const (
+	testRPID   = "ecampus.example.ac.id"
+	testOrigin = "https://ecampus.example.ac.id"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a software P-256 authenticator producing "none"
+// attestations and assertions
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+// create answers navigator.credentials.create()
+func (a *softAuthenticator) create(challenge string, flags byte) json.RawMessage {
+	clientData := a.clientData("webauthn.create", challenge)
+
+	authData := a.authData(flags | flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, a.coseKey()...)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	attestation := []byte{0xa3}
+	attestation = append(attestation, cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, 0xa0)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(authData)...)
+
+	return a.marshal(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers navigator.credentials.get()
+func (a *softAuthenticator) get(challenge string, flags byte, userHandle []byte) json.RawMessage {
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(flags)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.marshal(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(userHandle),
+	})
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	a.counter++
+
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.counter)
+}
+
+// coseKey encodes the public key as {1: 2, 3: -7, -1: 1, -2: x, -3: y}
+func (a *softAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	key := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21}
+	key = append(key, cborBytes(x)...)
+	key = append(key, 0x22)
+	return append(key, cborBytes(y)...)
+}
+
+func (a *softAuthenticator) marshal(response map[string]interface{}) json.RawMessage {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func cborText(s string) []byte {
+	return append([]byte{0x60 | byte(len(s))}, s...)
+}
+
+func cborBytes(b []byte) []byte {
+	if len(b) < 24 {
+		return append([]byte{0x40 | byte(len(b))}, b...)
+	}
+	return append([]byte{0x58, byte(len(b))}, b...)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+
+	s := NewWebAuthnService(nil, nil, config.Config{WebAuthn: config.WebAuthn{
+		RPID:          testRPID,
+		RPDisplayName: "E-Campus",
+		RPOrigins:     []string{testOrigin},
+	}}, nil)
+
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return relyingParty
+}
+
+// register runs a registration ceremony and returns the stored credential
+func register(t *testing.T, relyingParty *webauthn.WebAuthn, user *webAuthnUser, authenticator *softAuthenticator, flags byte) (*webauthn.Credential, error) {
+	t.Helper()
+
+	creation, session, err := relyingParty.BeginRegistration(user, registrationOptions(user)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creation.Response.AuthenticatorSelection.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("registration user verification = %q, want required", creation.Response.AuthenticatorSelection.UserVerification)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(authenticator.create(session.Challenge, flags))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return relyingParty.CreateCredential(user, *session, parsed)
+}
+
+// login runs an assertion ceremony, offering the user's credentials or, when
+// discoverable, letting the authenticator pick the account
+func login(t *testing.T, relyingParty *webauthn.WebAuthn, user *webAuthnUser, authenticator *softAuthenticator, flags byte, discoverable bool) (*webAuthnUser, error) {
+	t.Helper()
+
+	var session *webauthn.SessionData
+	var err error
+	if discoverable {
+		_, session, err = relyingParty.BeginDiscoverableLogin(loginOptions...)
+	} else {
+		_, session, err = relyingParty.BeginLogin(user, loginOptions...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("login user verification = %q, want required", session.UserVerification)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(authenticator.get(session.Challenge, flags, user.WebAuthnID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loadUser := func(userID int64) (*webAuthnUser, error) {
+		if userID != user.user.ID {
+			return nil, errors.New("unknown user")
+		}
+		return user, nil
+	}
+
+	found, _, err := validateAssertion(relyingParty, *session, parsed, loadUser)
+	return found, err
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	relyingParty := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &webAuthnUser{user: models.User{BaseUser: models.BaseUser{ID: 42, Email: "student@example.ac.id", Name: "Student"}}}
+
+	credential, err := register(t, relyingParty, user, authenticator, flagUserPresent|flagUserVerified)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	user.credentials = append(user.credentials, *credential)
+
+	for _, discoverable := range []bool{false, true} {
+		found, err := login(t, relyingParty, user, authenticator, flagUserPresent|flagUserVerified, discoverable)
+		if err != nil {
+			t.Fatalf("login (discoverable %v) failed: %v", discoverable, err)
+		}
+		if found.user.ID != user.user.ID {
+			t.Fatalf("login (discoverable %v) found user %d, want %d", discoverable, found.user.ID, user.user.ID)
+		}
+	}
+}
+
+func TestWebAuthnRequiresUserVerification(t *testing.T) {
+	relyingParty := newTestRelyingParty(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &webAuthnUser{user: models.User{BaseUser: models.BaseUser{ID: 42, Email: "student@example.ac.id", Name: "Student"}}}
+
+	if _, err := register(t, relyingParty, user, authenticator, flagUserPresent); err == nil {
+		t.Fatal("registration without user verification was accepted")
+	}
+
+	credential, err := register(t, relyingParty, user, authenticator, flagUserPresent|flagUserVerified)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	user.credentials = append(user.credentials, *credential)
+
+	for _, discoverable := range []bool{false, true} {
+		if _, err := login(t, relyingParty, user, authenticator, flagUserPresent, discoverable); err == nil {
+			t.Fatalf("login (discoverable %v) without user verification was accepted", discoverable)
+		}
+	}
+}
+
+func TestWebAuthnRejectsUnknownCredential(t *testing.T) {
+	relyingParty := newTestRelyingParty(t)
+	user := &webAuthnUser{user: models.User{BaseUser: models.BaseUser{ID: 42, Email: "student@example.ac.id", Name: "Student"}}}
+
+	credential, err := register(t, relyingParty, user, newSoftAuthenticator(t), flagUserPresent|flagUserVerified)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	user.credentials = append(user.credentials, *credential)
+
+	if _, err := login(t, relyingParty, user, newSoftAuthenticator(t), flagUserPresent|flagUserVerified, false); err == nil {
+		t.Fatal("login with an unregistered authenticator was accepted")
+	}
+}
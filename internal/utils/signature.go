@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// ErrInvalidSignature is returned for values that were not signed by SignValue
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// SignValue returns "payload.kid.signature", all parts URL-safe. The payload
+// is readable by anyone; use GenerateSessionEncryption for secrets.
+func SignValue(payload string, cfg config.Config) (string, error) {
+	keyID, key, err := cfg.ActiveKey()
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + keyID + "." + sign(key, encoded, keyID), nil
+}
+
+// VerifySignedValue checks a value produced by SignValue and returns its payload
+func VerifySignedValue(signed string, cfg config.Config) (string, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidSignature
+	}
+
+	encoded, keyID, signature := parts[0], parts[1], parts[2]
+	key, err := cfg.Key(keyID)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(key, encoded, keyID))) {
+		return "", ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	return string(payload), nil
+}
+
+// sign derives a separate MAC key so the encryption key is never used directly
+func sign(key []byte, encoded, keyID string) string {
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("e-campus signing key"))
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write([]byte(encoded + "." + keyID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -4,53 +4,172 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/bwmarrin/snowflake"
 	"github.com/matthewhartstonge/argon2"
 	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
 	"io"
+	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	snowflakeNode     *snowflake.Node
+	snowflakeNodeOnce sync.Once
+)
+
+// node returns the shared snowflake node so ids generated within the same
+// millisecond still get distinct sequence numbers.
+func node() *snowflake.Node {
+	snowflakeNodeOnce.Do(func() {
+		n, err := snowflake.NewNode(1)
+		if err != nil {
+			panic(err)
+		}
+		snowflakeNode = n
+	})
+	return snowflakeNode
+}
+
 func GenerateId() int64 {
-	node, err := snowflake.NewNode(1)
-	if err != nil {
-		panic(err)
-	}
-	return node.Generate().Int64()
+	return node().Generate().Int64()
 }
 
-func HashData(data string) (string, error) {
-	argon := argon2.DefaultConfig()
+// UnusablePassword is stored for accounts that cannot log in with a password
+// until one is set through the reset flow
+const UnusablePassword = "!"
+
+// ErrUnsupportedHash is returned for stored passwords that are not argon2 hashes
+var ErrUnsupportedHash = errors.New("unsupported password hash")
 
-	encoded, err := argon.HashEncoded([]byte(data))
+// HashData hashes data with the given argon2 parameters
+func HashData(data string, params argon2.Config) (string, error) {
+	encoded, err := params.HashEncoded([]byte(data))
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	return string(encoded), nil
 }
 
-func VerifyData(encodedHash, data string) (bool, error) {
-	ok, err := argon2.VerifyEncoded([]byte(data), []byte(encodedHash))
+// VerifyData checks data against an encoded argon2 hash. outdated reports
+// whether the hash was created with parameters other than params.
+func VerifyData(encodedHash, data string, params argon2.Config) (ok bool, outdated bool, err error) {
+	raw, err := argon2.Decode([]byte(encodedHash))
 	if err != nil {
-		panic(err) // 💥
+		return false, false, ErrUnsupportedHash
 	}
 
-	return ok, nil
+	ok, err = raw.Verify([]byte(data))
+	if err != nil {
+		return false, false, err
+	}
+
+	return ok, raw.Config != params, nil
+}
+
+// IsPasswordHash reports whether a value may be stored in users.password
+func IsPasswordHash(value string) bool {
+	if value == UnusablePassword {
+		return true
+	}
+
+	raw, err := argon2.Decode([]byte(value))
+	return err == nil && (raw.Config.Mode == argon2.ModeArgon2id || raw.Config.Mode == argon2.ModeArgon2i)
 }
 
 func GenerateSessionToken() int64 {
-	node, err := snowflake.NewNode(1)
-	if err != nil {
-		panic(err)
+	return node().Generate().Int64()
+}
+
+// GenerateRandomToken returns n random bytes encoded as URL-safe base64
+func GenerateRandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
 	}
-	return node.Generate().Int64()
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
+// GenerateRandomHex returns n random bytes encoded as hex
+func GenerateRandomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token, used as the
+// lookup key so raw tokens are never stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSessionEncryption encrypts a value with the active key. The result
+// is prefixed with the key id ("kid.ciphertext") so it can still be decrypted
+// after the active key is rotated.
 func GenerateSessionEncryption(sessionToken string, cfg config.Config) (string, error) {
+	keyID, key, err := cfg.ActiveKey()
+	if err != nil {
+		return "", err
+	}
+
+	return encrypt(sessionToken, keyID, key)
+}
+
+// DecryptSessionToken decrypts a value produced by GenerateSessionEncryption
+// with whichever key it names. Values without a key id use the legacy APP_SECRET.
+func DecryptSessionToken(token string, cfg config.Config) (string, error) {
+	return decrypt(token, cfg.Key)
+}
+
+// EncryptSecret encrypts a value stored in the database, such as a TOTP
+// secret, with the active data key. Stored values outlive session tokens, so
+// they use their own keyring; see config.DataKeys.
+func EncryptSecret(value string, cfg config.Config) (string, error) {
+	keyID, key, err := cfg.ActiveDataKey()
+	if err != nil {
+		return "", err
+	}
+
+	return encrypt(value, keyID, key)
+}
+
+// DecryptSecret decrypts a value produced by EncryptSecret. Values stored
+// before DATA_KEYS existed were encrypted with the session keyring and are
+// still read from it until reencrypt-secrets has moved them.
+func DecryptSecret(value string, cfg config.Config) (string, error) {
+	plaintext, err := decrypt(value, cfg.DataKey)
+	if err == nil {
+		return plaintext, nil
+	}
+
+	if legacy, legacyErr := decrypt(value, cfg.Key); legacyErr == nil {
+		return legacy, nil
+	}
+
+	return "", err
+}
+
+// SecretKeyID returns the id of the key a stored value was encrypted with
+func SecretKeyID(value string) string {
+	keyID, _, ok := strings.Cut(value, ".")
+	if !ok {
+		return config.LegacyKeyID
+	}
+	return keyID
+}
+
+func encrypt(plaintext, keyID string, key []byte) (string, error) {
 	// Create a new AES cipher block
-	block, err := aes.NewCipher([]byte(cfg.AppSecret))
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -68,15 +187,29 @@ func GenerateSessionEncryption(sessionToken string, cfg config.Config) (string,
 	}
 
 	// Encrypt the data
-	ciphertext := gcm.Seal(nonce, nonce, []byte(sessionToken), nil)
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 
 	// Encode the ciphertext in base64
-	return base64.URLEncoding.EncodeToString(ciphertext), nil
+	encoded := base64.URLEncoding.EncodeToString(ciphertext)
+	if keyID == config.LegacyKeyID {
+		return encoded, nil
+	}
+	return keyID + "." + encoded, nil
 }
 
-func DecryptSessionToken(token string, cfg config.Config) (string, error) {
+func decrypt(value string, keyFor func(id string) ([]byte, error)) (string, error) {
+	keyID := config.LegacyKeyID
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		keyID, value = value[:i], value[i+1:]
+	}
+
+	key, err := keyFor(keyID)
+	if err != nil {
+		return "", err
+	}
+
 	// Create a new AES cipher block
-	block, err := aes.NewCipher([]byte(cfg.AppSecret))
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -87,12 +220,16 @@ func DecryptSessionToken(token string, cfg config.Config) (string, error) {
 		return "", err
 	}
 
-	// Decode the token from base64
-	ciphertext, err := base64.URLEncoding.DecodeString(token)
+	// Decode the value from base64
+	ciphertext, err := base64.URLEncoding.DecodeString(value)
 	if err != nil {
 		return "", err
 	}
 
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("token too short")
+	}
+
 	// Decrypt the data
 	plaintext, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
 	if err != nil {
@@ -102,13 +239,35 @@ func DecryptSessionToken(token string, cfg config.Config) (string, error) {
 	return string(plaintext), nil
 }
 
-func ParseSessionToken(token string) (int64, int64, error) {
-	var userId, sessionId int64
-	_, err := fmt.Sscanf(token, "%d::%d", &userId, &sessionId)
+// GenerateEncryptionKey returns a new random 256-bit key id and its base64
+// encoding, ready to be appended to APP_KEYS
+func GenerateEncryptionKey() (string, string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", "", err
+	}
 
-	if err != nil {
-		panic(err)
+	return fmt.Sprintf("k%d", time.Now().Unix()), base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseSessionToken parses a decrypted access token of the form
+// "userId::sessionId::expiresAt".
+func ParseSessionToken(token string) (int64, int64, int64, error) {
+	var userId, sessionId, expiresAt int64
+	if _, err := fmt.Sscanf(token, "%d::%d::%d", &userId, &sessionId, &expiresAt); err != nil {
+		return 0, 0, 0, err
+	}
+
+	return userId, sessionId, expiresAt, nil
+}
+
+// ParseRefreshToken parses a decrypted refresh token of the form
+// "refresh::userId::sessionId::refreshId".
+func ParseRefreshToken(token string) (int64, int64, int64, error) {
+	var userId, sessionId, refreshId int64
+	if _, err := fmt.Sscanf(token, "refresh::%d::%d::%d", &userId, &sessionId, &refreshId); err != nil {
+		return 0, 0, 0, err
 	}
 
-	return userId, sessionId, nil
+	return userId, sessionId, refreshId, nil
 }
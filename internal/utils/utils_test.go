@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func keyringConfig(activeID string, ids ...string) config.Config {
+	ring := make(map[string]string, len(ids))
+	for i, id := range ids {
+		ring[id] = testKey(byte('a' + i))
+	}
+	return config.Config{Keys: config.Keys{ActiveID: activeID, Ring: ring}}
+}
+
+func TestSessionEncryptionRoundTrip(t *testing.T) {
+	cfg := keyringConfig("k2", "k1", "k2")
+
+	token, err := GenerateSessionEncryption("42::7::1700000000", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "k2.") {
+		t.Errorf("token %q is not prefixed with the active key id", token)
+	}
+
+	plaintext, err := DecryptSessionToken(token, cfg)
+	if err != nil {
+		t.Fatalf("DecryptSessionToken failed: %v", err)
+	}
+	if plaintext != "42::7::1700000000" {
+		t.Errorf("DecryptSessionToken = %q, want 42::7::1700000000", plaintext)
+	}
+}
+
+func TestSessionEncryptionAfterRotation(t *testing.T) {
+	before := keyringConfig("k1", "k1")
+	token, err := GenerateSessionEncryption("token", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 becomes active; k1 is retired but still listed
+	after := keyringConfig("k2", "k1", "k2")
+	plaintext, err := DecryptSessionToken(token, after)
+	if err != nil {
+		t.Fatalf("token made under the retired key was rejected: %v", err)
+	}
+	if plaintext != "token" {
+		t.Errorf("DecryptSessionToken = %q, want token", plaintext)
+	}
+
+	// Once k1 is dropped its tokens no longer decrypt
+	if _, err := DecryptSessionToken(token, keyringConfig("k2", "k2")); err == nil {
+		t.Error("token made under a removed key was accepted")
+	}
+}
+
+func TestSessionEncryptionLegacySecret(t *testing.T) {
+	legacy := config.Config{AppSecret: strings.Repeat("s", 32)}
+	token, err := GenerateSessionEncryption("token", legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(token, ".") {
+		t.Errorf("legacy token %q has a key id", token)
+	}
+
+	cfg := keyringConfig("k1", "k1")
+	cfg.AppSecret = legacy.AppSecret
+	if plaintext, err := DecryptSessionToken(token, cfg); err != nil || plaintext != "token" {
+		t.Errorf("DecryptSessionToken(legacy) = %q, %v, want token", plaintext, err)
+	}
+}
+
+func TestDecryptSessionTokenRejects(t *testing.T) {
+	cfg := keyringConfig("k1", "k1", "k2")
+
+	valid, err := GenerateSessionEncryption("token", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, encoded, _ := strings.Cut(valid, ".")
+
+	ciphertext, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 0x01
+	tampered := "k1." + base64.URLEncoding.EncodeToString(ciphertext)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown key id", "k9." + encoded},
+		{"another key's id", "k2." + encoded},
+		{"legacy token without APP_SECRET", encoded},
+		{"empty", ""},
+		{"key id only", "k1."},
+		{"not base64", "k1.!!!"},
+		{"shorter than a nonce", "k1." + base64.URLEncoding.EncodeToString([]byte("short"))},
+		{"tampered ciphertext", tampered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if plaintext, err := DecryptSessionToken(tt.token, cfg); err == nil {
+				t.Errorf("DecryptSessionToken(%q) = %q, want an error", tt.token, plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	cfg := keyringConfig("k1", "k1")
+	cfg.DataKeys = config.DataKeys{ActiveID: "d1", Ring: map[string]string{"d1": testKey('d')}}
+
+	// Secrets stored before DATA_KEYS existed were encrypted with the session keyring
+	stored, err := GenerateSessionEncryption("JBSWY3DPEHPK3PXP", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := EncryptSecret("JBSWY3DPEHPK3PXP", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SecretKeyID(secret) != "d1" {
+		t.Errorf("SecretKeyID = %q, want d1", SecretKeyID(secret))
+	}
+
+	for _, value := range []string{secret, stored} {
+		plaintext, err := DecryptSecret(value, cfg)
+		if err != nil {
+			t.Fatalf("DecryptSecret(%q) failed: %v", value, err)
+		}
+		if plaintext != "JBSWY3DPEHPK3PXP" {
+			t.Errorf("DecryptSecret(%q) = %q, want JBSWY3DPEHPK3PXP", value, plaintext)
+		}
+	}
+
+	// Data keys never decrypt session tokens
+	if _, err := DecryptSessionToken(secret, cfg); err == nil {
+		t.Error("DecryptSessionToken accepted a value encrypted with a data key")
+	}
+}
@@ -1,12 +1,146 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
 type Config struct {
 	ServerPort string `env:"SERVER_PORT" envDefault:"8080"`
 	Redis      string `env:"REDIS_URL"`
-	AppSecret  string `env:"APP_SECRET"`
+	AppSecret  string `env:"APP_SECRET"` // Legacy single key, still accepted for decryption
+	AppURL     string `env:"APP_URL" envDefault:"http://localhost:3000"`
 	Database
+	Keys     Keys
+	DataKeys DataKeys
+	Mail     Mail
+	OIDC     OIDC
+	Password Password
+	WebAuthn WebAuthn
+	Session  Session
+	Storage  Storage
+}
+
+// Validate checks the settings that cannot be expressed with env tags
+func (c Config) Validate() error {
+	if err := c.validateKeys(); err != nil {
+		return err
+	}
+
+	if err := c.validateDataKeys(); err != nil {
+		return err
+	}
+
+	if err := c.Password.validate(); err != nil {
+		return err
+	}
+
+	return c.Session.validate()
 }
 
 type Database struct {
 	Url string `env:"DATABASE_URL"`
 }
+
+// OIDC configures single sign-on against the campus identity provider.
+// SSO is disabled while OIDC_ISSUER_URL is empty.
+type OIDC struct {
+	IssuerURL            string   `env:"OIDC_ISSUER_URL"`
+	ClientID             string   `env:"OIDC_CLIENT_ID"`
+	ClientSecret         string   `env:"OIDC_CLIENT_SECRET"`
+	RedirectURL          string   `env:"OIDC_REDIRECT_URL"` // e.g. https://api.example.ac.id/auth/oidc/callback
+	Scopes               []string `env:"OIDC_SCOPES" envDefault:"openid,email,profile"`
+	EmailClaim           string   `env:"OIDC_EMAIL_CLAIM" envDefault:"email"`
+	NimNipClaim          string   `env:"OIDC_NIM_NIP_CLAIM"` // Claim holding the NIM/NIP, matched when email does not match
+	RequireVerifiedEmail bool     `env:"OIDC_REQUIRE_VERIFIED_EMAIL" envDefault:"true"`
+	PostLoginRedirectURL string   `env:"OIDC_POST_LOGIN_REDIRECT_URL"` // Frontend URL receiving tokens in the fragment; JSON is returned when empty
+}
+
+// WebAuthn configures passkey login. It is disabled while WEBAUTHN_RP_ID is empty.
+type WebAuthn struct {
+	RPID          string   `env:"WEBAUTHN_RP_ID"` // Domain the credentials are bound to, e.g. ecampus.example.ac.id
+	RPDisplayName string   `env:"WEBAUTHN_RP_NAME" envDefault:"E-Campus"`
+	RPOrigins     []string `env:"WEBAUTHN_RP_ORIGINS"` // Frontend origins allowed to run ceremonies, e.g. https://ecampus.example.ac.id
+}
+
+// Password configures the password policy and the argon2 parameters used for
+// new hashes. Hashes made with other parameters are upgraded on login.
+type Password struct {
+	MinLength        int    `env:"PASSWORD_MIN_LENGTH" envDefault:"10"`
+	MaxLength        int    `env:"PASSWORD_MAX_LENGTH" envDefault:"128"` // Bounds the cost of hashing
+	RequireUpper     bool   `env:"PASSWORD_REQUIRE_UPPER" envDefault:"true"`
+	RequireLower     bool   `env:"PASSWORD_REQUIRE_LOWER" envDefault:"true"`
+	RequireDigit     bool   `env:"PASSWORD_REQUIRE_DIGIT" envDefault:"true"`
+	RequireSymbol    bool   `env:"PASSWORD_REQUIRE_SYMBOL" envDefault:"false"`
+	BreachedListFile string `env:"PASSWORD_BREACHED_LIST_FILE"` // One password or SHA-1 hash (HIBP format) per line
+	Argon2Time       uint32 `env:"ARGON2_TIME" envDefault:"3"`
+	Argon2MemoryKiB  uint32 `env:"ARGON2_MEMORY_KIB" envDefault:"65536"`
+	Argon2Threads    uint8  `env:"ARGON2_THREADS" envDefault:"4"`
+}
+
+func (p Password) validate() error {
+	if p.MinLength < 8 {
+		return fmt.Errorf("PASSWORD_MIN_LENGTH must be at least 8, got %d", p.MinLength)
+	}
+	if p.MaxLength < p.MinLength {
+		return errors.New("PASSWORD_MAX_LENGTH must not be smaller than PASSWORD_MIN_LENGTH")
+	}
+	if p.Argon2Time == 0 || p.Argon2MemoryKiB == 0 || p.Argon2Threads == 0 {
+		return errors.New("ARGON2_TIME, ARGON2_MEMORY_KIB and ARGON2_THREADS must be positive")
+	}
+	if p.BreachedListFile != "" {
+		if _, err := os.Stat(p.BreachedListFile); err != nil {
+			return fmt.Errorf("PASSWORD_BREACHED_LIST_FILE: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Session holds the default session lifetimes. Roles can override them with a
+// row in session_policies.
+type Session struct {
+	IdleTimeout     time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"24h"`      // Sessions unused for this long expire
+	AbsoluteTimeout time.Duration `env:"SESSION_ABSOLUTE_TIMEOUT" envDefault:"720h"` // Sessions expire this long after login, however active
+	MaxConcurrent   int           `env:"SESSION_MAX_CONCURRENT" envDefault:"10"`     // Oldest sessions are evicted beyond this; 0 disables the limit
+}
+
+func (s Session) validate() error {
+	if s.IdleTimeout <= 0 {
+		return errors.New("SESSION_IDLE_TIMEOUT must be positive")
+	}
+	if s.AbsoluteTimeout < s.IdleTimeout {
+		return errors.New("SESSION_ABSOLUTE_TIMEOUT must not be shorter than SESSION_IDLE_TIMEOUT")
+	}
+	if s.MaxConcurrent < 0 {
+		return fmt.Errorf("SESSION_MAX_CONCURRENT must not be negative, got %d", s.MaxConcurrent)
+	}
+
+	return nil
+}
+
+// Storage selects where uploaded files, such as profile photos, are kept
+type Storage struct {
+	Driver      string        `env:"STORAGE_DRIVER" envDefault:"local"` // local or s3
+	LocalDir    string        `env:"STORAGE_LOCAL_DIR" envDefault:"storage"`
+	PublicURL   string        `env:"STORAGE_PUBLIC_URL" envDefault:"/storage"` // Base URL local files are served under
+	S3Endpoint  string        `env:"S3_ENDPOINT"`                              // host[:port] of any S3-compatible service
+	S3Region    string        `env:"S3_REGION"`
+	S3Bucket    string        `env:"S3_BUCKET"`
+	S3AccessKey string        `env:"S3_ACCESS_KEY"`
+	S3SecretKey string        `env:"S3_SECRET_KEY"`
+	S3UseSSL    bool          `env:"S3_USE_SSL" envDefault:"true"`
+	S3URLExpiry time.Duration `env:"S3_URL_EXPIRY" envDefault:"1h"` // Lifetime of signed download URLs
+}
+
+type Mail struct {
+	Driver       string `env:"MAIL_DRIVER" envDefault:"log"` // smtp or log
+	From         string `env:"MAIL_FROM" envDefault:"no-reply@e-campus.local"`
+	LogFile      string `env:"MAIL_LOG_FILE"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+}
@@ -15,5 +15,9 @@ func NewConfig() (config Config, err error) {
 		return
 	}
 
+	if err = config.Validate(); err != nil {
+		return
+	}
+
 	return
 }
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Keys is the keyring used to encrypt session tokens and other secrets.
+// APP_KEYS lists every key that may still decrypt ("id:base64,id:base64"),
+// APP_KEY_ID selects the one used for new tokens.
+type Keys struct {
+	ActiveID string            `env:"APP_KEY_ID"`
+	Ring     map[string]string `env:"APP_KEYS" envKeyValSeparator:":"`
+}
+
+// DataKeys is the keyring for secrets stored in the database, such as TOTP
+// secrets. Session tokens expire, so their keys can be dropped after a while;
+// stored secrets live as long as their row, so data keys are kept apart and a
+// key is only dropped once `e-campus-be reencrypt-secrets` has moved every
+// value to the active one. Without DATA_KEYS the session keyring is used.
+type DataKeys struct {
+	ActiveID string            `env:"DATA_KEY_ID"`
+	Ring     map[string]string `env:"DATA_KEYS" envKeyValSeparator:":"`
+}
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LegacyKeyID identifies values encrypted with APP_SECRET before the keyring existed
+const LegacyKeyID = ""
+
+// validateKeys checks that the active key exists and every key is a valid AES length
+func (c Config) validateKeys() error {
+	if len(c.Keys.Ring) == 0 {
+		if c.AppSecret == "" {
+			return errors.New("either APP_KEYS or APP_SECRET must be set")
+		}
+		if !validKeyLength(len(c.AppSecret)) {
+			return fmt.Errorf("APP_SECRET must be 16, 24 or 32 bytes, got %d", len(c.AppSecret))
+		}
+		return nil
+	}
+
+	for id := range c.Keys.Ring {
+		if !ValidKeyID(id) {
+			return fmt.Errorf("key id %q may only contain letters, digits, '-' and '_'", id)
+		}
+		if _, err := c.Key(id); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := c.Keys.Ring[c.Keys.ActiveID]; !ok {
+		return fmt.Errorf("APP_KEY_ID %q is not listed in APP_KEYS", c.Keys.ActiveID)
+	}
+
+	if c.AppSecret != "" && !validKeyLength(len(c.AppSecret)) {
+		return fmt.Errorf("APP_SECRET must be 16, 24 or 32 bytes, got %d", len(c.AppSecret))
+	}
+
+	return nil
+}
+
+// validateDataKeys checks DATA_KEYS the same way as APP_KEYS when it is set
+func (c Config) validateDataKeys() error {
+	if len(c.DataKeys.Ring) == 0 {
+		if c.DataKeys.ActiveID != "" {
+			return errors.New("DATA_KEY_ID is set but DATA_KEYS is empty")
+		}
+		return nil
+	}
+
+	for id := range c.DataKeys.Ring {
+		if !ValidKeyID(id) {
+			return fmt.Errorf("data key id %q may only contain letters, digits, '-' and '_'", id)
+		}
+		if _, err := c.DataKey(id); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := c.DataKeys.Ring[c.DataKeys.ActiveID]; !ok {
+		return fmt.Errorf("DATA_KEY_ID %q is not listed in DATA_KEYS", c.DataKeys.ActiveID)
+	}
+
+	return nil
+}
+
+// ActiveKey returns the id and bytes of the key new values are encrypted with.
+// Without a keyring the legacy APP_SECRET is used.
+func (c Config) ActiveKey() (string, []byte, error) {
+	if len(c.Keys.Ring) == 0 {
+		key, err := c.Key(LegacyKeyID)
+		return LegacyKeyID, key, err
+	}
+
+	key, err := c.Key(c.Keys.ActiveID)
+	return c.Keys.ActiveID, key, err
+}
+
+// Key returns the decoded key for an id
+func (c Config) Key(id string) ([]byte, error) {
+	if id == LegacyKeyID {
+		if c.AppSecret == "" {
+			return nil, errors.New("no legacy APP_SECRET configured")
+		}
+		return []byte(c.AppSecret), nil
+	}
+
+	encoded, ok := c.Keys.Ring[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+
+	return decodeKey(id, encoded)
+}
+
+// ActiveDataKey returns the id and bytes of the key stored secrets are
+// encrypted with, falling back to the session keyring without DATA_KEYS
+func (c Config) ActiveDataKey() (string, []byte, error) {
+	if len(c.DataKeys.Ring) == 0 {
+		return c.ActiveKey()
+	}
+
+	key, err := c.DataKey(c.DataKeys.ActiveID)
+	return c.DataKeys.ActiveID, key, err
+}
+
+// DataKey returns the decoded data key for an id
+func (c Config) DataKey(id string) ([]byte, error) {
+	if len(c.DataKeys.Ring) == 0 {
+		return c.Key(id)
+	}
+
+	encoded, ok := c.DataKeys.Ring[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown data key id %q", id)
+	}
+
+	return decodeKey(id, encoded)
+}
+
+func decodeKey(id, encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+	}
+	if !validKeyLength(len(key)) {
+		return nil, fmt.Errorf("key %q must decode to 16, 24 or 32 bytes, got %d", id, len(key))
+	}
+
+	return key, nil
+}
+
+// ValidKeyID reports whether id can be used in APP_KEYS and as a token prefix
+func ValidKeyID(id string) bool {
+	return keyIDPattern.MatchString(id)
+}
+
+func validKeyLength(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
@@ -0,0 +1,417 @@
+// Package listquery parses the query string of list endpoints into filters,
+// sorting and pagination, restricted to the fields an endpoint whitelists.
+//
+//	?status[in]=active,on_leave&entry_year[gte]=2022   filters
+//	?sort=-created_at,name                             sort, "-" for descending
+//	?limit=20&cursor=...                               keyset pagination
+//	?limit=20&page=3                                   offset pagination
+//
+// A filter without an operator, such as ?role=admin, compares for equality.
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+// Type is the type of a field's values, used to parse them from the query string
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Time // RFC 3339 or YYYY-MM-DD
+	Bool
+)
+
+// Field is a column a list may be filtered or sorted by
+type Field[T any] struct {
+	Column string // Qualified column, e.g. "users.created_at"
+	Type   Type
+	Filter bool
+	// Sort fields must be NOT NULL columns and need Value, which reads the
+	// field from an item to build the cursor of the next page
+	Sort  bool
+	Value func(item T) any
+}
+
+// Spec describes what a list endpoint allows
+type Spec[T any] struct {
+	Fields       map[string]Field[T]
+	DefaultSort  string // e.g. "-created_at"
+	Key          string // Unique sortable field added to every sort so the order is total, e.g. "id"
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Operators accepted in field[op]=value filters
+var operators = map[string]exp.BooleanOperation{
+	"eq":  exp.EqOp,
+	"neq": exp.NeqOp,
+	"gt":  exp.GtOp,
+	"gte": exp.GteOp,
+	"lt":  exp.LtOp,
+	"lte": exp.LteOp,
+	"in":  exp.InOp,
+	"nin": exp.NotInOp,
+}
+
+// Filter is a parsed field[op]=value parameter
+type Filter struct {
+	Field  string
+	Column string
+	Op     string
+	Values []any // A single value unless Op is "in" or "nin"
+}
+
+type Sort struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Query is a parsed list request
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+	Offset  int  // Set for ?page, zero otherwise
+	Sorted  bool // Whether ?sort was given rather than the default sort
+	after   []any
+	sortKey string
+}
+
+// HasCursor reports whether the query continues from a cursor
+func (q Query) HasCursor() bool {
+	return q.after != nil
+}
+
+// Error is a problem with the query string, to be reported as a bad request
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorf(format string, args ...any) error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// Parse reads a query string. Parameters that are not fields of the spec are
+// left to the endpoint, except field[op] filters on unknown fields.
+func (s Spec[T]) Parse(values url.Values) (Query, error) {
+	query := Query{Limit: s.DefaultLimit}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > s.MaxLimit {
+			return query, errorf("limit must be between 1 and %d", s.MaxLimit)
+		}
+		query.Limit = n
+	}
+
+	sort := values.Get("sort")
+	query.Sorted = sort != ""
+	if !query.Sorted {
+		sort = s.DefaultSort
+	}
+	if err := s.parseSort(&query, sort); err != nil {
+		return query, err
+	}
+
+	for param, raw := range values {
+		name, op, hasOp := strings.Cut(param, "[")
+		if hasOp {
+			if !strings.HasSuffix(op, "]") {
+				return query, errorf("invalid filter %s", param)
+			}
+			op = strings.TrimSuffix(op, "]")
+		} else {
+			op = "eq"
+		}
+
+		field, ok := s.Fields[name]
+		if !ok {
+			if hasOp {
+				return query, errorf("%s cannot be filtered", name)
+			}
+			continue
+		}
+		if !field.Filter {
+			return query, errorf("%s cannot be filtered", name)
+		}
+		if _, ok := operators[op]; !ok {
+			return query, errorf("unknown filter operator %s", op)
+		}
+
+		for _, value := range raw {
+			filter := Filter{Field: name, Column: field.Column, Op: op}
+
+			parts := []string{value}
+			if op == "in" || op == "nin" {
+				parts = strings.Split(value, ",")
+			}
+			for _, part := range parts {
+				parsed, err := parseValue(field.Type, strings.TrimSpace(part))
+				if err != nil {
+					return query, errorf("%s: %v", param, err)
+				}
+				filter.Values = append(filter.Values, parsed)
+			}
+
+			query.Filters = append(query.Filters, filter)
+		}
+	}
+
+	cursor, page := values.Get("cursor"), values.Get("page")
+	switch {
+	case cursor != "" && page != "":
+		return query, errorf("cursor and page cannot be combined")
+	case cursor != "":
+		after, err := s.decodeCursor(query, cursor)
+		if err != nil {
+			return query, err
+		}
+		query.after = after
+	case page != "":
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return query, errorf("page must be a positive number")
+		}
+		// The offset must fit in an int; no list gets anywhere near that deep
+		if n > math.MaxInt/query.Limit {
+			return query, errorf("page is too large")
+		}
+		query.Offset = (n - 1) * query.Limit
+	}
+
+	return query, nil
+}
+
+func (s Spec[T]) parseSort(query *Query, sort string) error {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(sort, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if name == "" {
+			continue
+		}
+
+		field, ok := s.Fields[name]
+		if !ok || !field.Sort {
+			return errorf("cannot sort by %s", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		query.Sort = append(query.Sort, Sort{Field: name, Column: field.Column, Desc: desc})
+	}
+
+	// The key makes rows with equal sort values page in a stable order
+	if !seen[s.Key] {
+		key := s.Fields[s.Key]
+		query.Sort = append(query.Sort, Sort{Field: s.Key, Column: key.Column})
+	}
+
+	parts := make([]string, len(query.Sort))
+	for i, sort := range query.Sort {
+		parts[i] = sort.Field
+		if sort.Desc {
+			parts[i] = "-" + sort.Field
+		}
+	}
+	query.sortKey = strings.Join(parts, ",")
+
+	return nil
+}
+
+func parseValue(fieldType Type, value string) (any, error) {
+	switch fieldType {
+	case Int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	case Time:
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date or RFC 3339 time", value)
+		}
+		return t, nil
+	case Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not true or false", value)
+		}
+		return b, nil
+	default:
+		return value, nil
+	}
+}
+
+// Where returns the filter conditions, which apply to counts and exports as
+// well as to the page itself
+func (q Query) Where() []exp.Expression {
+	conditions := make([]exp.Expression, 0, len(q.Filters))
+	for _, filter := range q.Filters {
+		column := goqu.I(filter.Column)
+		switch filter.Op {
+		case "in":
+			conditions = append(conditions, column.In(filter.Values...))
+		case "nin":
+			conditions = append(conditions, column.NotIn(filter.Values...))
+		default:
+			conditions = append(conditions, exp.NewBooleanExpression(operators[filter.Op], column, filter.Values[0]))
+		}
+	}
+	return conditions
+}
+
+// Order returns the ORDER BY expressions of the sort
+func (q Query) Order() []exp.OrderedExpression {
+	order := make([]exp.OrderedExpression, len(q.Sort))
+	for i, sort := range q.Sort {
+		if sort.Desc {
+			order[i] = goqu.I(sort.Column).Desc()
+		} else {
+			order[i] = goqu.I(sort.Column).Asc()
+		}
+	}
+	return order
+}
+
+// Page applies the sort and pagination to a filtered dataset. One row more
+// than the limit is selected so Spec.Next can tell whether there is a next page.
+func (q Query) Page(dataset *goqu.SelectDataset) *goqu.SelectDataset {
+	dataset = dataset.Order(q.Order()...).Limit(uint(q.Limit + 1))
+
+	if q.Offset > 0 {
+		dataset = dataset.Offset(uint(q.Offset))
+	}
+	if q.after != nil {
+		dataset = dataset.Where(q.seek())
+	}
+
+	return dataset
+}
+
+// seek selects the rows after the cursor: (a > x) OR (a = x AND b > y) ...,
+// with < for descending fields
+func (q Query) seek() exp.Expression {
+	alternatives := make([]exp.Expression, len(q.Sort))
+	for i, sort := range q.Sort {
+		conditions := make([]exp.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, goqu.I(q.Sort[j].Column).Eq(q.after[j]))
+		}
+
+		column := goqu.I(sort.Column)
+		if sort.Desc {
+			conditions = append(conditions, column.Lt(q.after[i]))
+		} else {
+			conditions = append(conditions, column.Gt(q.after[i]))
+		}
+
+		alternatives[i] = goqu.And(conditions...)
+	}
+	return goqu.Or(alternatives...)
+}
+
+// Next trims the extra row selected by Page and returns the cursor of the
+// next page, or "" on the last page
+func (s Spec[T]) Next(q Query, items []T) ([]T, string) {
+	if len(items) <= q.Limit {
+		return items, ""
+	}
+	items = items[:q.Limit]
+
+	last := items[len(items)-1]
+	values := make([]any, len(q.Sort))
+	for i, sort := range q.Sort {
+		values[i] = s.Fields[sort.Field].Value(last)
+	}
+
+	data, err := json.Marshal(cursor{Sort: q.sortKey, Values: values})
+	if err != nil {
+		return items, ""
+	}
+
+	return items, base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursor is the content of an opaque cursor. It is tied to the sort it was
+// made for, since its values are meaningless with another one.
+type cursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+}
+
+func (s Spec[T]) decodeCursor(q Query, encoded string) ([]any, error) {
+	invalid := errorf("invalid cursor")
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var raw struct {
+		Sort   string            `json:"s"`
+		Values []json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, invalid
+	}
+	if raw.Sort != q.sortKey {
+		return nil, errorf("cursor was made for another sort")
+	}
+	if len(raw.Values) != len(q.Sort) {
+		return nil, invalid
+	}
+
+	values := make([]any, len(raw.Values))
+	for i, sort := range q.Sort {
+		var value any
+		switch s.Fields[sort.Field].Type {
+		case Int:
+			var n int64
+			err = json.Unmarshal(raw.Values[i], &n)
+			value = n
+		case Time:
+			var t time.Time
+			err = json.Unmarshal(raw.Values[i], &t)
+			value = t
+		case Bool:
+			var b bool
+			err = json.Unmarshal(raw.Values[i], &b)
+			value = b
+		default:
+			var str string
+			err = json.Unmarshal(raw.Values[i], &str)
+			value = str
+		}
+		if err != nil {
+			return nil, invalid
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
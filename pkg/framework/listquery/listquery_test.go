@@ -0,0 +1,331 @@
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+type testItem struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+var testSpec = Spec[testItem]{
+	Fields: map[string]Field[testItem]{
+		"id":         {Column: "items.id", Type: Int, Filter: true, Sort: true, Value: func(i testItem) any { return i.ID }},
+		"name":       {Column: "items.name", Type: String, Filter: true, Sort: true, Value: func(i testItem) any { return i.Name }},
+		"created_at": {Column: "items.created_at", Type: Time, Filter: true, Sort: true, Value: func(i testItem) any { return i.CreatedAt }},
+		"active":     {Column: "items.active", Type: Bool, Filter: true},
+		"secret":     {Column: "items.secret", Type: String},
+	},
+	DefaultSort:  "id",
+	Key:          "id",
+	DefaultLimit: 10,
+	MaxLimit:     100,
+}
+
+func mustParse(t *testing.T, query string) Query {
+	t.Helper()
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := testSpec.Parse(values)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", query, err)
+	}
+	return parsed
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		limit   int
+		offset  int
+		filters []Filter
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			limit: 10,
+		},
+		{
+			name:  "limit at maximum",
+			query: "limit=100",
+			limit: 100,
+		},
+		{
+			name:   "page",
+			query:  "limit=20&page=3",
+			limit:  20,
+			offset: 40,
+		},
+		{
+			name:    "equality without operator",
+			query:   "name=alice",
+			limit:   10,
+			filters: []Filter{{Field: "name", Column: "items.name", Op: "eq", Values: []any{"alice"}}},
+		},
+		{
+			name:    "in is split and trimmed",
+			query:   "id[in]=1, 2,3",
+			limit:   10,
+			filters: []Filter{{Field: "id", Column: "items.id", Op: "in", Values: []any{int64(1), int64(2), int64(3)}}},
+		},
+		{
+			name:    "nin is split",
+			query:   "name[nin]=a,b",
+			limit:   10,
+			filters: []Filter{{Field: "name", Column: "items.name", Op: "nin", Values: []any{"a", "b"}}},
+		},
+		{
+			name:    "other operators are not split",
+			query:   "name[neq]=a,b",
+			limit:   10,
+			filters: []Filter{{Field: "name", Column: "items.name", Op: "neq", Values: []any{"a,b"}}},
+		},
+		{
+			name:    "date",
+			query:   "created_at[gte]=2024-02-01",
+			limit:   10,
+			filters: []Filter{{Field: "created_at", Column: "items.created_at", Op: "gte", Values: []any{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}}},
+		},
+		{
+			name:    "RFC 3339 time",
+			query:   "created_at[lt]=2024-02-01T10:30:00Z",
+			limit:   10,
+			filters: []Filter{{Field: "created_at", Column: "items.created_at", Op: "lt", Values: []any{time.Date(2024, 2, 1, 10, 30, 0, 0, time.UTC)}}},
+		},
+		{
+			name:    "bool",
+			query:   "active=true",
+			limit:   10,
+			filters: []Filter{{Field: "active", Column: "items.active", Op: "eq", Values: []any{true}}},
+		},
+		{
+			name:  "unknown parameters are left to the endpoint",
+			query: "q=search&include_deleted=true",
+			limit: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := mustParse(t, tt.query)
+
+			if query.Limit != tt.limit {
+				t.Errorf("Limit = %d, want %d", query.Limit, tt.limit)
+			}
+			if query.Offset != tt.offset {
+				t.Errorf("Offset = %d, want %d", query.Offset, tt.offset)
+			}
+			if !reflect.DeepEqual(query.Filters, tt.filters) {
+				t.Errorf("Filters = %#v, want %#v", query.Filters, tt.filters)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cursor := encodeCursor(t, "id", int64(5))
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"limit zero", "limit=0"},
+		{"limit above maximum", "limit=101"},
+		{"limit not a number", "limit=ten"},
+		{"unknown field with operator", "missing[eq]=1"},
+		{"field that cannot be filtered", "secret=x"},
+		{"unknown operator", "id[like]=1"},
+		{"unterminated operator", "id[gte=1"},
+		{"value of the wrong type", "id=abc"},
+		{"value in a list of the wrong type", "id[in]=1,x"},
+		{"invalid date", "created_at=yesterday"},
+		{"invalid bool", "active=maybe"},
+		{"sort by unknown field", "sort=missing"},
+		{"sort by field that cannot be sorted", "sort=active"},
+		{"page zero", "page=0"},
+		{"page not a number", "page=two"},
+		{"page overflowing the offset", "limit=10&page=" + strconv.Itoa(math.MaxInt/10+1)},
+		{"cursor and page together", "page=2&cursor=" + cursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = testSpec.Parse(values)
+			if _, ok := err.(*Error); !ok {
+				t.Errorf("Parse(%q) error = %v, want *Error", tt.query, err)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		query  string
+		sorted bool
+		sort   []Sort
+	}{
+		{
+			query: "",
+			sort:  []Sort{{Field: "id", Column: "items.id"}},
+		},
+		{
+			query:  "sort=-created_at,name",
+			sorted: true,
+			sort: []Sort{
+				{Field: "created_at", Column: "items.created_at", Desc: true},
+				{Field: "name", Column: "items.name"},
+				{Field: "id", Column: "items.id"},
+			},
+		},
+		{
+			query:  "sort=-id,name,-id",
+			sorted: true,
+			sort: []Sort{
+				{Field: "id", Column: "items.id", Desc: true},
+				{Field: "name", Column: "items.name"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		query := mustParse(t, tt.query)
+		if query.Sorted != tt.sorted {
+			t.Errorf("Parse(%q).Sorted = %v, want %v", tt.query, query.Sorted, tt.sorted)
+		}
+		if !reflect.DeepEqual(query.Sort, tt.sort) {
+			t.Errorf("Parse(%q).Sort = %+v, want %+v", tt.query, query.Sort, tt.sort)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	tests := []struct {
+		name string
+		sort string
+		next testItem
+		want string
+	}{
+		{
+			name: "key only",
+			sort: "",
+			next: testItem{ID: 7},
+			want: `SELECT * FROM "items" WHERE ("items"."id" > 7)`,
+		},
+		{
+			name: "descending then ascending",
+			sort: "-created_at,name",
+			next: testItem{ID: 7, Name: "bob", CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+			want: `SELECT * FROM "items" WHERE (("items"."created_at" < '2024-02-01T00:00:00Z') OR (("items"."created_at" = '2024-02-01T00:00:00Z') AND ("items"."name" > 'bob')) OR (("items"."created_at" = '2024-02-01T00:00:00Z') AND ("items"."name" = 'bob') AND ("items"."id" > 7)))`,
+		},
+		{
+			name: "descending key",
+			sort: "name,-id",
+			next: testItem{ID: 7, Name: "bob"},
+			want: `SELECT * FROM "items" WHERE (("items"."name" > 'bob') OR (("items"."name" = 'bob') AND ("items"."id" < 7)))`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := mustParse(t, "limit=1&sort="+tt.sort)
+			_, cursor := testSpec.Next(query, []testItem{tt.next, {}})
+			query = mustParse(t, "limit=1&sort="+tt.sort+"&cursor="+cursor)
+
+			got, _, err := goqu.From("items").Where(query.seek()).ToSQL()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("seek SQL =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	items := []testItem{
+		{ID: 1, Name: "a", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, Name: "b", CreatedAt: time.Date(2024, 1, 2, 8, 15, 0, 0, time.UTC)},
+		{ID: 3, Name: "c", CreatedAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	query := mustParse(t, "limit=2&sort=-created_at,name")
+	page, cursor := testSpec.Next(query, items)
+	if len(page) != 2 {
+		t.Fatalf("Next returned %d items, want 2", len(page))
+	}
+	if cursor == "" {
+		t.Fatal("Next returned no cursor with more items left")
+	}
+
+	next := mustParse(t, "limit=2&sort=-created_at,name&cursor="+cursor)
+	if !next.HasCursor() {
+		t.Fatal("HasCursor() = false after parsing a cursor")
+	}
+	want := []any{items[1].CreatedAt, items[1].Name, items[1].ID}
+	if !reflect.DeepEqual(next.after, want) {
+		t.Errorf("cursor values = %#v, want %#v", next.after, want)
+	}
+
+	if _, cursor := testSpec.Next(query, items[:2]); cursor != "" {
+		t.Errorf("Next on the last page returned cursor %q", cursor)
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	otherSort := mustParse(t, "limit=1&sort=name")
+	_, otherCursor := testSpec.Next(otherSort, []testItem{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("cursor"))},
+		{"made for another sort", otherCursor},
+		{"too few values", encodeCursor(t, "id")},
+		{"too many values", encodeCursor(t, "id", int64(1), int64(2))},
+		{"value of the wrong type", encodeCursor(t, "id", "one")},
+	}
+
+	query := mustParse(t, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testSpec.decodeCursor(query, tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q) accepted the cursor", tt.cursor)
+			}
+		})
+	}
+}
+
+// encodeCursor builds a cursor for the given sort key and values
+func encodeCursor(t *testing.T, sortKey string, values ...any) string {
+	t.Helper()
+
+	data, err := json.Marshal(cursor{Sort: sortKey, Values: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_two_factor (
+                                 user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                                 secret TEXT NOT NULL,
+                                 enabled_at TIMESTAMP,
+                                 last_used_step BIGINT NOT NULL DEFAULT 0,
+                                 created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                 updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE user_recovery_codes (
+                                     id BIGSERIAL PRIMARY KEY,
+                                     user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     code_hash VARCHAR(64) NOT NULL,
+                                     used_at TIMESTAMP,
+                                     created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE two_factor_policies (
+                                     role user_role PRIMARY KEY,
+                                     required BOOLEAN NOT NULL DEFAULT FALSE,
+                                     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+CREATE INDEX idx_user_recovery_codes_user ON user_recovery_codes(user_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS two_factor_policies;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_two_factor;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE security_events (
+                                 id BIGSERIAL PRIMARY KEY,
+                                 event_type VARCHAR(50) NOT NULL,
+                                 user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+                                 actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+                                 email VARCHAR(255),
+                                 ip VARCHAR(64),
+                                 user_agent TEXT,
+                                 details TEXT,
+                                 created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+CREATE INDEX idx_security_events_user ON security_events(user_id);
+CREATE INDEX idx_security_events_email ON security_events(email);
+CREATE INDEX idx_security_events_created_at ON security_events(created_at);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS security_events;
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE service_accounts (
+                                  id BIGSERIAL PRIMARY KEY,
+                                  name VARCHAR(255) NOT NULL UNIQUE,
+                                  description TEXT,
+                                  created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+                                  disabled_at TIMESTAMP,
+                                  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE api_keys (
+                          id BIGSERIAL PRIMARY KEY,
+                          service_account_id BIGINT NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+                          prefix VARCHAR(16) NOT NULL UNIQUE,
+                          key_hash VARCHAR(64) NOT NULL,
+                          scopes TEXT NOT NULL DEFAULT '',
+                          expires_at TIMESTAMP NOT NULL,
+                          last_used_at TIMESTAMP,
+                          revoked_at TIMESTAMP,
+                          created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE api_key_requests (
+                                  id BIGSERIAL PRIMARY KEY,
+                                  api_key_id BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+                                  method VARCHAR(10) NOT NULL,
+                                  path TEXT NOT NULL,
+                                  status INT NOT NULL,
+                                  ip VARCHAR(64),
+                                  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+CREATE INDEX idx_api_keys_service_account ON api_keys(service_account_id);
+CREATE INDEX idx_api_key_requests_api_key ON api_key_requests(api_key_id);
+CREATE INDEX idx_api_key_requests_created_at ON api_key_requests(created_at);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_key_requests;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
+-- +goose StatementEnd
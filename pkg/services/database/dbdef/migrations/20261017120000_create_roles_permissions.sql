@@ -0,0 +1,72 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE roles (
+                       name VARCHAR(50) PRIMARY KEY,
+                       description TEXT NOT NULL DEFAULT '',
+                       is_system BOOLEAN NOT NULL DEFAULT FALSE,
+                       created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                       updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+                             name VARCHAR(100) PRIMARY KEY,
+                             description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+                                  role VARCHAR(50) NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, is_system) VALUES
+    ('admin', 'Campus administrators', TRUE),
+    ('lecture', 'Teaching staff', TRUE),
+    ('student', 'Enrolled students', TRUE);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'View user profiles'),
+    ('users:create', 'Create users'),
+    ('users:update', 'Update users'),
+    ('users:delete', 'Delete users'),
+    ('users:unlock', 'Lift login lockouts'),
+    ('sessions:revoke', 'Log other users out of their sessions'),
+    ('roles:manage', 'Manage roles and their permissions'),
+    ('two-factor:manage', 'Manage two-factor authentication policies'),
+    ('service-accounts:manage', 'Manage service accounts and API keys'),
+    ('grades:publish', 'Publish course grades');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('lecture', 'users:read'),
+    ('lecture', 'grades:publish'),
+    ('student', 'users:read');
+
+-- Roles become rows instead of enum values so they can be managed at runtime
+ALTER TABLE users ALTER COLUMN role TYPE VARCHAR(50) USING role::TEXT;
+ALTER TABLE users ADD CONSTRAINT fk_users_role
+    FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+
+ALTER TABLE two_factor_policies ALTER COLUMN role TYPE VARCHAR(50) USING role::TEXT;
+ALTER TABLE two_factor_policies ADD CONSTRAINT fk_two_factor_policies_role
+    FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE;
+
+DROP TYPE IF EXISTS user_role;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TYPE user_role AS ENUM('admin', 'lecture', 'student');
+
+ALTER TABLE two_factor_policies DROP CONSTRAINT IF EXISTS fk_two_factor_policies_role;
+ALTER TABLE two_factor_policies ALTER COLUMN role TYPE user_role USING role::user_role;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_users_role;
+ALTER TABLE users ALTER COLUMN role TYPE user_role USING role::user_role;
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
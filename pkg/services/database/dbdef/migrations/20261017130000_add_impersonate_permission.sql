@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as another user in a read-only session');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:impersonate');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:impersonate';
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Anything that is not an argon2 hash (such as the seeded 'hashed_password'
+-- or a plain text password) can never be used to log in. Replace it with the
+-- unusable marker so the user has to go through the password reset flow.
+UPDATE users
+SET password = '!', updated_at = NOW()
+WHERE password !~ '^\$argon2(id|i)\$';
+
+ALTER TABLE users ADD CONSTRAINT chk_users_password_hash
+    CHECK (password = '!' OR password ~ '^\$argon2(id|i)\$');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_users_password_hash;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE admissions (
+                            id BIGSERIAL PRIMARY KEY,
+                            nim_nip VARCHAR(100) NOT NULL UNIQUE,
+                            email VARCHAR(255) NOT NULL,
+                            name VARCHAR(255) NOT NULL,
+                            department_code VARCHAR(255) REFERENCES departments(code) ON DELETE SET NULL,
+                            entry_year INT,
+                            created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                            updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE registrations (
+                               user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                               admission_id BIGINT NOT NULL UNIQUE REFERENCES admissions(id) ON DELETE CASCADE,
+                               verification_expires_at TIMESTAMP NOT NULL,
+                               verified_at TIMESTAMP,
+                               decision VARCHAR(20), -- approved or rejected by an admin
+                               reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+                               reviewed_at TIMESTAMP,
+                               created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('registrations:manage', 'Manage the admission list and review student registrations');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'registrations:manage');
+-- +goose StatementEnd
+
+CREATE UNIQUE INDEX idx_admissions_email ON admissions(LOWER(email));
+CREATE INDEX idx_registrations_expires_at ON registrations(verification_expires_at);
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'registrations:manage';
+DROP TABLE IF EXISTS registrations;
+DROP TABLE IF EXISTS admissions;
+-- +goose StatementEnd
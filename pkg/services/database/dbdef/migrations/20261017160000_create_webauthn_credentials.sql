@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webauthn_credentials (
+                                      id BIGSERIAL PRIMARY KEY,
+                                      user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                      credential_id BYTEA NOT NULL UNIQUE,
+                                      name VARCHAR(100) NOT NULL,
+                                      credential JSONB NOT NULL, -- Public key, sign counter and flags
+                                      last_used_at TIMESTAMP,
+                                      created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webauthn_credentials;
+-- +goose StatementEnd
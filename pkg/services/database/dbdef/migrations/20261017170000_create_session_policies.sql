@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE session_policies (
+                                  role VARCHAR(50) PRIMARY KEY REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+                                  idle_timeout_seconds INTEGER CHECK (idle_timeout_seconds > 0),
+                                  absolute_timeout_seconds INTEGER CHECK (absolute_timeout_seconds > 0),
+                                  max_sessions INTEGER CHECK (max_sessions >= 0),
+                                  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('sessions:manage', 'Configure session timeouts and limits per role');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'sessions:manage');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'sessions:manage';
+DROP TABLE IF EXISTS session_policies;
+-- +goose StatementEnd
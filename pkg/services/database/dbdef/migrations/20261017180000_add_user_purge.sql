@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN purged_at TIMESTAMP;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:purge', 'Anonymize deleted users');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:purge');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:purge';
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS purged_at;
+-- +goose StatementEnd
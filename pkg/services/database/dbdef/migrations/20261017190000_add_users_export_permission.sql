@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (name, description) VALUES
+    ('users:export', 'Download user lists as CSV or XLSX');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:export');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:export';
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE nim_nip_rules (
+                               id BIGSERIAL PRIMARY KEY,
+                               role VARCHAR(50) NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+                               department_code VARCHAR(255) REFERENCES departments(code) ON UPDATE CASCADE ON DELETE CASCADE,
+                               template VARCHAR(100) NOT NULL,
+                               created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                               updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One rule per role and department, plus one default per role
+CREATE UNIQUE INDEX idx_nim_nip_rules_role_department ON nim_nip_rules (role, COALESCE(department_code, ''));
+
+-- Last number handed out per scope, the identifier with its sequence part left out
+CREATE TABLE nim_nip_sequences (
+                                   scope VARCHAR(255) PRIMARY KEY,
+                                   last_value BIGINT NOT NULL
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('numbering:manage', 'Configure NIM/NIP numbering rules');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'numbering:manage');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'numbering:manage';
+DROP TABLE IF EXISTS nim_nip_sequences;
+DROP TABLE IF EXISTS nim_nip_rules;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Fails while duplicates exist; `e-campus-be nim-nip -fix` renumbers them
+ALTER TABLE users ADD CONSTRAINT users_nim_nip_key UNIQUE (nim_nip);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_nim_nip_key;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_status_history (
+                                     id BIGSERIAL PRIMARY KEY,
+                                     user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     from_status VARCHAR(50),
+                                     to_status VARCHAR(50) NOT NULL,
+                                     reason TEXT,
+                                     effective_date DATE NOT NULL,
+                                     actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+                                     created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_status_history_user ON user_status_history (user_id, effective_date);
+
+UPDATE users SET status = 'active' WHERE status IS NULL OR status = '';
+
+-- Existing users start their history with the status they have now
+INSERT INTO user_status_history (user_id, to_status, effective_date, created_at)
+SELECT id, status, created_at::date, NOW() FROM users;
+
+-- NOT VALID keeps rows with legacy values; every new write is checked
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN (
+    'active', 'pending_verification', 'rejected', 'on_leave',
+    'suspended', 'graduated', 'dropped_out', 'transferred'
+)) NOT VALID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+DROP TABLE IF EXISTS user_status_history;
+-- +goose StatementEnd
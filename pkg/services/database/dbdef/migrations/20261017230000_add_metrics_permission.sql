@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (name, description) VALUES
+    ('metrics:read', 'View operational metrics such as cache hit rates');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'metrics:read');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'metrics:read';
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The role was seeded as 'lecture' while the code expects models.RoleLecturer.
+-- Every reference to roles(name) is ON UPDATE CASCADE, so users, permissions,
+-- session and two-factor policies and numbering rules follow the rename.
+UPDATE roles SET name = 'lecturer', updated_at = NOW() WHERE name = 'lecture';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE roles SET name = 'lecture', updated_at = NOW() WHERE name = 'lecturer';
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE lecturer_profiles (
+                                   user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                                   nidn VARCHAR(10) UNIQUE CHECK (nidn ~ '^[0-9]{10}$'),
+                                   academic_rank VARCHAR(50) CHECK (academic_rank IN ('asisten_ahli', 'lektor', 'lektor_kepala', 'guru_besar')),
+                                   accepting_advisees BOOLEAN NOT NULL DEFAULT TRUE,
+                                   max_advisees INT NOT NULL DEFAULT 20 CHECK (max_advisees >= 0),
+                                   max_teaching_credits INT NOT NULL DEFAULT 12 CHECK (max_teaching_credits >= 0),
+                                   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                   updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE lecturer_expertise (
+                                    user_id BIGINT NOT NULL REFERENCES lecturer_profiles(user_id) ON DELETE CASCADE,
+                                    area VARCHAR(100) NOT NULL,
+                                    PRIMARY KEY (user_id, area)
+);
+
+CREATE INDEX idx_lecturer_expertise_area_trgm ON lecturer_expertise USING GIN (area gin_trgm_ops);
+
+CREATE TABLE lecturer_education (
+                                    id BIGSERIAL PRIMARY KEY,
+                                    user_id BIGINT NOT NULL REFERENCES lecturer_profiles(user_id) ON DELETE CASCADE,
+                                    degree VARCHAR(20) NOT NULL CHECK (degree IN ('bachelor', 'master', 'doctorate', 'professional')),
+                                    field VARCHAR(255) NOT NULL,
+                                    institution VARCHAR(255) NOT NULL,
+                                    graduation_year INT
+);
+
+CREATE INDEX idx_lecturer_education_user ON lecturer_education (user_id);
+
+-- Every existing lecturer starts with an empty profile
+INSERT INTO lecturer_profiles (user_id)
+SELECT id FROM users WHERE role = 'lecturer';
+
+-- Advisors and class lecturers must have a profile, which holds their
+-- capacity. NOT VALID keeps legacy rows pointing at other users.
+ALTER TABLE study_plans ADD CONSTRAINT fk_study_plans_advisor_profile
+    FOREIGN KEY (advisor_id) REFERENCES lecturer_profiles(user_id) NOT VALID;
+ALTER TABLE class_schedules ADD CONSTRAINT fk_class_schedules_lecturer_profile
+    FOREIGN KEY (lecturer_id) REFERENCES lecturer_profiles(user_id) NOT VALID;
+
+INSERT INTO permissions (name, description) VALUES
+    ('lecturers:manage', 'Manage lecturer profiles and view advisor and teaching candidates');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'lecturers:manage');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'lecturers:manage';
+
+ALTER TABLE class_schedules DROP CONSTRAINT IF EXISTS fk_class_schedules_lecturer_profile;
+ALTER TABLE study_plans DROP CONSTRAINT IF EXISTS fk_study_plans_advisor_profile;
+
+DROP TABLE IF EXISTS lecturer_education;
+DROP TABLE IF EXISTS lecturer_expertise;
+DROP TABLE IF EXISTS lecturer_profiles;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- users_status_check was added NOT VALID, so rows still holding a legacy
+-- status could not be updated at all until their status changed. Map them to
+-- the statuses the code knows: 'inactive' students are treated as on leave,
+-- anything else unknown is suspended until an admin reviews it. The mapping is
+-- recorded in the status history.
+WITH legacy AS (
+    SELECT id, status FROM users
+    WHERE status IS NULL OR status NOT IN (
+        'active', 'pending_verification', 'rejected', 'on_leave',
+        'suspended', 'graduated', 'dropped_out', 'transferred'
+    )
+), mapped AS (
+    UPDATE users SET
+        status = CASE
+            WHEN LOWER(TRIM(COALESCE(legacy.status, ''))) IN ('', 'active', 'aktif') THEN 'active'
+            WHEN LOWER(TRIM(legacy.status)) IN ('inactive', 'nonaktif', 'non-aktif', 'cuti', 'on leave', 'on_leave') THEN 'on_leave'
+            WHEN LOWER(TRIM(legacy.status)) IN ('graduated', 'lulus', 'alumni') THEN 'graduated'
+            WHEN LOWER(TRIM(legacy.status)) IN ('dropped_out', 'dropped out', 'do', 'keluar') THEN 'dropped_out'
+            WHEN LOWER(TRIM(legacy.status)) IN ('transferred', 'pindah') THEN 'transferred'
+            ELSE 'suspended'
+        END,
+        updated_at = NOW()
+    FROM legacy
+    WHERE users.id = legacy.id
+    RETURNING users.id, legacy.status AS from_status, users.status AS to_status
+)
+INSERT INTO user_status_history (user_id, from_status, to_status, reason, effective_date)
+SELECT id, from_status, to_status, 'Mapped from a legacy status', CURRENT_DATE FROM mapped;
+
+ALTER TABLE users VALIDATE CONSTRAINT users_status_check;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Mapped statuses are not restored; the constraint only goes back to NOT VALID
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN (
+    'active', 'pending_verification', 'rejected', 'on_leave',
+    'suspended', 'graduated', 'dropped_out', 'transferred'
+)) NOT VALID;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type MailerParams struct {
+	fx.In
+
+	Config config.Config
+	Logger *zap.Logger
+}
+
+// NewMailer returns the backend selected by MAIL_DRIVER
+func NewMailer(p MailerParams) (Mailer, error) {
+	switch p.Config.Mail.Driver {
+	case "smtp":
+		return NewSMTPMailer(p.Config.Mail), nil
+	case "log", "":
+		return NewLogMailer(p.Config.Mail, p.Logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", p.Config.Mail.Driver)
+	}
+}
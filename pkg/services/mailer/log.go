@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+	"go.uber.org/zap"
+)
+
+// LogMailer is a development backend that appends messages to MAIL_LOG_FILE,
+// or writes them to the application log when no file is configured.
+type LogMailer struct {
+	mu     sync.Mutex
+	from   string
+	path   string
+	logger *zap.Logger
+}
+
+func NewLogMailer(cfg config.Mail, logger *zap.Logger) *LogMailer {
+	return &LogMailer{
+		from:   cfg.From,
+		path:   cfg.LogFile,
+		logger: logger,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.path == "" {
+		m.logger.Info("Email sent",
+			zap.Strings("to", msg.To),
+			zap.String("subject", msg.Subject),
+			zap.String("body", msg.Body),
+		)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(buildMessage(m.from, msg), "\r\n\r\n"...)); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache is a read-through cache of JSON encoded values of one type, stored
+// under a key format taking a single id. A nil *Cache caches nothing, so
+// callers without Redis (such as CLI commands) can share the same code.
+//
+// Redis failures never fail a lookup: the value is loaded from the source
+// instead and the failure is counted in the cache's stats.
+type Cache[T any] struct {
+	client    *redis.Client
+	keyFormat string
+	ttl       time.Duration
+	stats     *cacheStats
+}
+
+// NewCache returns a cache on the Redis connection, or nil when there is none.
+// name identifies the cache in CacheStats.
+func NewCache[T any](db *ECampusRedisDB, name, keyFormat string, ttl time.Duration) *Cache[T] {
+	if db == nil || db.Client == nil {
+		return nil
+	}
+
+	return &Cache[T]{
+		client:    db.Client,
+		keyFormat: keyFormat,
+		ttl:       ttl,
+		stats:     statsFor(name),
+	}
+}
+
+// GetOrLoad returns the cached value for id, or calls load and caches its
+// result. Errors from load are returned as is and nothing is cached.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, id string, load func() (*T, error)) (*T, error) {
+	if c == nil {
+		return load()
+	}
+
+	key := fmt.Sprintf(c.keyFormat, id)
+	data, err := c.client.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			c.stats.hits.Add(1)
+			return &value, nil
+		}
+		// An entry written by an older version of the type; replace it
+		c.stats.misses.Add(1)
+	case errors.Is(err, redis.Nil):
+		c.stats.misses.Add(1)
+	default:
+		c.stats.misses.Add(1)
+		c.stats.errors.Add(1)
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(value); err == nil {
+		if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+			c.stats.errors.Add(1)
+		}
+	}
+
+	return value, nil
+}
+
+// Delete evicts ids from the cache. It is called after every write to the
+// source; a failed eviction leaves the entry until its TTL expires.
+func (c *Cache[T]) Delete(ctx context.Context, ids ...string) {
+	if c == nil || len(ids) == 0 {
+		return
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf(c.keyFormat, id)
+	}
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		c.stats.errors.Add(1)
+	}
+}
+
+// cacheStats counts the lookups of a cache since the process started
+type cacheStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+// CacheStat is a snapshot of the counters of a cache
+type CacheStat struct {
+	Name    string  `json:"name"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`   // Including lookups that failed and were served from the source
+	Errors  int64   `json:"errors"`   // Failed Redis reads and writes
+	HitRate float64 `json:"hit_rate"` // Hits per lookup, 0 without lookups
+}
+
+// registry holds the stats of every cache by name. Caches are created per
+// request, so their counters live here rather than on the Cache.
+var registry = struct {
+	sync.Mutex
+	stats map[string]*cacheStats
+}{stats: make(map[string]*cacheStats)}
+
+func statsFor(name string) *cacheStats {
+	registry.Lock()
+	defer registry.Unlock()
+
+	stats, ok := registry.stats[name]
+	if !ok {
+		stats = &cacheStats{}
+		registry.stats[name] = stats
+	}
+	return stats
+}
+
+// CacheStats returns the counters of every cache used so far, sorted by name
+func CacheStats() []CacheStat {
+	registry.Lock()
+	defer registry.Unlock()
+
+	snapshot := make([]CacheStat, 0, len(registry.stats))
+	for name, stats := range registry.stats {
+		stat := CacheStat{
+			Name:   name,
+			Hits:   stats.hits.Load(),
+			Misses: stats.misses.Load(),
+			Errors: stats.errors.Load(),
+		}
+		if lookups := stat.Hits + stat.Misses; lookups > 0 {
+			stat.HitRate = float64(stat.Hits) / float64(lookups)
+		}
+		snapshot = append(snapshot, stat)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Name < snapshot[j].Name
+	})
+
+	return snapshot
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps uploaded files under slash separated keys such as
+// "users/42/photo/small.jpg"
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL clients can download the object from. Depending on
+	// the backend it is served by this application or signed and short-lived.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// NewStorage returns the backend selected by STORAGE_DRIVER
+func NewStorage(cfg config.Config) (Storage, error) {
+	switch cfg.Storage.Driver {
+	case "local", "":
+		return NewLocalStorage(cfg.Storage)
+	case "s3":
+		return NewS3Storage(cfg.Storage)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rafaalrazzak/e-campus-be/pkg/framework/config"
+)
+
+// S3Storage keeps files in a bucket of any S3-compatible service and hands
+// out presigned download URLs, so the bucket can stay private
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	expiry time.Duration
+}
+
+func NewS3Storage(cfg config.Storage) (*S3Storage, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: cfg.S3Bucket,
+		expiry: cfg.S3URLExpiry,
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) URL(ctx context.Context, key string) (string, error) {
+	signed, err := s.client.PresignedGetObject(ctx, s.bucket, key, s.expiry, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL for %s: %w", key, err)
+	}
+
+	return signed.String(), nil
+}